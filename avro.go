@@ -0,0 +1,295 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+)
+
+// AvroSchema is a parsed Avro schema that can generate random values in the
+// Avro binary encoding.
+type AvroSchema struct {
+	Type string
+
+	// Name is set for named types: records, enums, and fixed types
+	Name string
+
+	Fields  []AvroField   // record
+	Symbols []string      // enum
+	Size    int           // fixed
+	Items   *AvroSchema   // array
+	Values  *AvroSchema   // map
+	Union   []*AvroSchema // union
+
+	// stop is the union branch that ends recursion soonest, which is picked
+	// when values are nested deeply
+	stop int
+}
+
+type AvroField struct {
+	Name   string
+	Schema *AvroSchema
+}
+
+// ReadAvroSchema reads an Avro schema in JSON from a file.
+func ReadAvroSchema(name string) (*AvroSchema, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, fmt.Errorf("invalid Avro schema: %w", err)
+	}
+	s, err := parseAvroSchema(v, make(map[string]*AvroSchema))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Avro schema: %w", err)
+	}
+	if err := s.limitRecursion(); err != nil {
+		return nil, fmt.Errorf("invalid Avro schema: %w", err)
+	}
+	return s, nil
+}
+
+func parseAvroSchema(v interface{}, named map[string]*AvroSchema) (*AvroSchema, error) {
+	switch v := v.(type) {
+	case string:
+		switch v {
+		case "null", "boolean", "int", "long", "float", "double", "bytes", "string":
+			return &AvroSchema{Type: v}, nil
+		}
+		if s, ok := named[v]; ok {
+			return s, nil
+		}
+		return nil, fmt.Errorf("unknown type %q", v)
+
+	case []interface{}:
+		s := &AvroSchema{Type: "union"}
+		for _, b := range v {
+			bs, err := parseAvroSchema(b, named)
+			if err != nil {
+				return nil, err
+			}
+			s.Union = append(s.Union, bs)
+		}
+		if len(s.Union) == 0 {
+			return nil, fmt.Errorf("union has no types")
+		}
+		return s, nil
+
+	case map[string]interface{}:
+		t, _ := v["type"].(string)
+		name, _ := v["name"].(string)
+		s := &AvroSchema{Type: t, Name: name}
+
+		switch t {
+		case "record", "error":
+			s.Type = "record"
+			// register the record first so that fields can refer to it
+			named[name] = s
+			fields, _ := v["fields"].([]interface{})
+			for _, f := range fields {
+				fm, ok := f.(map[string]interface{})
+				if !ok {
+					return nil, fmt.Errorf("record %s has an invalid field", name)
+				}
+				fs, err := parseAvroSchema(fm["type"], named)
+				if err != nil {
+					return nil, err
+				}
+				fname, _ := fm["name"].(string)
+				s.Fields = append(s.Fields, AvroField{Name: fname, Schema: fs})
+			}
+		case "enum":
+			symbols, _ := v["symbols"].([]interface{})
+			for _, sym := range symbols {
+				str, _ := sym.(string)
+				s.Symbols = append(s.Symbols, str)
+			}
+			if len(s.Symbols) == 0 {
+				return nil, fmt.Errorf("enum %s has no symbols", name)
+			}
+			named[name] = s
+		case "fixed":
+			size, _ := v["size"].(float64)
+			s.Size = int(size)
+			named[name] = s
+		case "array":
+			items, err := parseAvroSchema(v["items"], named)
+			if err != nil {
+				return nil, err
+			}
+			s.Items = items
+		case "map":
+			values, err := parseAvroSchema(v["values"], named)
+			if err != nil {
+				return nil, err
+			}
+			s.Values = values
+		default:
+			// primitive types may also be written as objects, possibly
+			// with a logical type, which is ignored
+			return parseAvroSchema(t, named)
+		}
+		return s, nil
+	}
+	return nil, fmt.Errorf("invalid schema %v", v)
+}
+
+// limitRecursion checks that every record in s can have a finite value and
+// sets the branch of each union that ends recursion soonest.
+func (s *AvroSchema) limitRecursion() error {
+	var nodes []*AvroSchema
+	seen := make(map[*AvroSchema]bool)
+	var walk func(*AvroSchema)
+	walk = func(s *AvroSchema) {
+		if s == nil || seen[s] {
+			return
+		}
+		seen[s] = true
+		nodes = append(nodes, s)
+		for _, f := range s.Fields {
+			walk(f.Schema)
+		}
+		for _, b := range s.Union {
+			walk(b)
+		}
+		walk(s.Items)
+		walk(s.Values)
+	}
+	walk(s)
+
+	// height is the fewest nested records and unions in a value of each
+	// type; arrays and maps can be empty, so only records can be infinite
+	const inf = math.MaxInt32
+	height := make(map[*AvroSchema]int, len(nodes))
+	for _, n := range nodes {
+		height[n] = inf
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, n := range nodes {
+			h := 0
+			switch n.Type {
+			case "record":
+				for _, f := range n.Fields {
+					if height[f.Schema] > h {
+						h = height[f.Schema]
+					}
+				}
+			case "union":
+				h = inf
+				for _, b := range n.Union {
+					if height[b] < h {
+						h = height[b]
+					}
+				}
+			}
+			if h < inf && (n.Type == "record" || n.Type == "union") {
+				h++
+			}
+			if h < height[n] {
+				height[n] = h
+				changed = true
+			}
+		}
+	}
+
+	for _, n := range nodes {
+		switch {
+		case n.Type == "record" && height[n] == inf:
+			return fmt.Errorf("record %s always contains itself", n.Name)
+		case n.Type == "union":
+			for i, b := range n.Union {
+				if h := height[b]; h < height[n.Union[n.stop]] || (h == 0 && b.Type == "null") {
+					n.stop = i
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Append appends a random value of the schema's type in the Avro binary
+// encoding. Recursive types stop recursing after a few levels by picking
+// the union branches that end soonest, preferring null, and empty arrays and
+// maps.
+func (s *AvroSchema) Append(dst []byte, r *rand.Rand) []byte {
+	return s.append(dst, r, 0)
+}
+
+func (s *AvroSchema) append(dst []byte, r *rand.Rand, depth int) []byte {
+	switch s.Type {
+	case "null":
+		return dst
+	case "boolean":
+		return append(dst, byte(r.Intn(2)))
+	case "int":
+		return avroAppendLong(dst, int64(int32(r.Uint32())))
+	case "long":
+		return avroAppendLong(dst, int64(r.Uint64()))
+	case "float":
+		return protoAppendFixed32(dst, math.Float32bits(r.Float32()*1000))
+	case "double":
+		return protoAppendFixed64(dst, math.Float64bits(r.Float64()*1000))
+	case "bytes":
+		n := 1 + r.Intn(16)
+		dst = avroAppendLong(dst, int64(n))
+		for i := 0; i < n; i++ {
+			dst = append(dst, byte(r.Intn(256)))
+		}
+		return dst
+	case "string":
+		return avroAppendString(dst, randomString(r, 1+r.Intn(32)))
+	case "fixed":
+		for i := 0; i < s.Size; i++ {
+			dst = append(dst, byte(r.Intn(256)))
+		}
+		return dst
+	case "enum":
+		return avroAppendLong(dst, int64(r.Intn(len(s.Symbols))))
+	case "record":
+		for _, f := range s.Fields {
+			dst = f.Schema.append(dst, r, depth+1)
+		}
+		return dst
+	case "union":
+		i := r.Intn(len(s.Union))
+		if depth > maxGeneratedDepth {
+			i = s.stop
+		}
+		dst = avroAppendLong(dst, int64(i))
+		return s.Union[i].append(dst, r, depth+1)
+	case "array", "map":
+		n := 0
+		if depth <= maxGeneratedDepth {
+			n = r.Intn(5)
+		}
+		if n > 0 {
+			dst = avroAppendLong(dst, int64(n))
+			for i := 0; i < n; i++ {
+				if s.Type == "map" {
+					dst = avroAppendString(dst, randomString(r, 1+r.Intn(8)))
+					dst = s.Values.append(dst, r, depth+1)
+				} else {
+					dst = s.Items.append(dst, r, depth+1)
+				}
+			}
+		}
+		return avroAppendLong(dst, 0)
+	}
+	return dst
+}
+
+// avroAppendLong appends a zig-zag encoded variable-length integer.
+func avroAppendLong(dst []byte, v int64) []byte {
+	return protoAppendVarint(dst, uint64(v<<1)^uint64(v>>63))
+}
+
+func avroAppendString(dst []byte, s string) []byte {
+	dst = avroAppendLong(dst, int64(len(s)))
+	return append(dst, s...)
+}
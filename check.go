@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func checkMain(args []string) {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: rndout check [flags] [file]")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Check the sequence numbers in output generated with -sequence for missing,")
+		fmt.Fprintln(fs.Output(), "duplicated, and reordered lines. Exits with status 1 if lines are missing or")
+		fmt.Fprintln(fs.Output(), "duplicated.")
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+
+	examples := fs.Int("examples", 5, "maximum number of example ranges to report for each problem")
+	listen := fs.String("listen", "", "read from the first TCP connection accepted on this host:port instead of a file")
+	fs.Parse(args)
+
+	in, err := openInput(fs.Arg(0), *listen)
+	if err != nil {
+		die(err)
+	}
+	defer in.Close()
+
+	c := NewSequenceChecker(*examples)
+	if err := c.Check(in); err != nil {
+		die(err)
+	}
+
+	c.Report(os.Stdout)
+	if c.Missing() > 0 || c.Duplicated.Count > 0 {
+		os.Exit(1)
+	}
+}
+
+// SeqRanges counts sequence numbers and keeps example ranges of them.
+type SeqRanges struct {
+	Count  int64
+	Ranges [][2]uint64
+	max    int
+}
+
+func (r *SeqRanges) Add(seq uint64) {
+	r.AddRange(seq, seq)
+}
+
+// AddRange adds the sequence numbers from lo to hi, inclusive.
+func (r *SeqRanges) AddRange(lo, hi uint64) {
+	r.Count += int64(hi - lo + 1)
+	if n := len(r.Ranges); n > 0 && r.Ranges[n-1][1]+1 == lo {
+		r.Ranges[n-1][1] = hi
+		return
+	}
+	if len(r.Ranges) < r.max {
+		r.Ranges = append(r.Ranges, [2]uint64{lo, hi})
+	}
+}
+
+func (r SeqRanges) String() string {
+	if r.Count == 0 {
+		return "0"
+	}
+
+	examples := make([]string, len(r.Ranges))
+	for i, rng := range r.Ranges {
+		if rng[0] == rng[1] {
+			examples[i] = strconv.FormatUint(rng[0], 10)
+		} else {
+			examples[i] = fmt.Sprintf("%d-%d", rng[0], rng[1])
+		}
+	}
+	return fmt.Sprintf("%d (%s)", r.Count, strings.Join(examples, ", "))
+}
+
+// SequenceChecker tracks the sequence numbers seen in a stream.
+type SequenceChecker struct {
+	Lines      int64
+	Malformed  int64
+	Duplicated SeqRanges
+	Reordered  SeqRanges
+
+	// seen holds the ranges of sequence numbers seen, sorted and not
+	// adjacent, so that memory grows with the number of gaps instead of the
+	// largest sequence number
+	seen     [][2]uint64
+	next     uint64
+	examples int
+}
+
+func NewSequenceChecker(examples int) *SequenceChecker {
+	return &SequenceChecker{
+		Duplicated: SeqRanges{max: examples},
+		Reordered:  SeqRanges{max: examples},
+		examples:   examples,
+	}
+}
+
+// Check reads lines from r until EOF.
+func (c *SequenceChecker) Check(r io.Reader) error {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadSlice('\n')
+		if len(line) > 0 {
+			c.line(line)
+		}
+
+		// skip the rest of lines that are longer than the buffer
+		for errors.Is(err, bufio.ErrBufferFull) {
+			_, err = br.ReadSlice('\n')
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (c *SequenceChecker) line(line []byte) {
+	c.Lines++
+
+	end := 0
+	for end < len(line) && line[end] >= '0' && line[end] <= '9' {
+		end++
+	}
+	if end == 0 || end == len(line) || line[end] != ' ' {
+		c.Malformed++
+		return
+	}
+
+	seq, err := strconv.ParseUint(string(line[:end]), 10, 64)
+	if err != nil {
+		c.Malformed++
+		return
+	}
+	c.Add(seq)
+}
+
+// Add records a sequence number.
+func (c *SequenceChecker) Add(seq uint64) {
+	// i is the first range that ends at or after seq
+	i := sort.Search(len(c.seen), func(i int) bool { return c.seen[i][1] >= seq })
+	switch {
+	case i < len(c.seen) && c.seen[i][0] <= seq:
+		c.Duplicated.Add(seq)
+		return
+	case seq < c.next:
+		c.Reordered.Add(seq)
+	}
+
+	joinPrev := i > 0 && c.seen[i-1][1]+1 == seq
+	joinNext := i < len(c.seen) && c.seen[i][0] == seq+1
+	switch {
+	case joinPrev && joinNext:
+		c.seen[i-1][1] = c.seen[i][1]
+		c.seen = append(c.seen[:i], c.seen[i+1:]...)
+	case joinPrev:
+		c.seen[i-1][1] = seq
+	case joinNext:
+		c.seen[i][0] = seq
+	default:
+		c.seen = append(c.seen, [2]uint64{})
+		copy(c.seen[i+1:], c.seen[i:])
+		c.seen[i] = [2]uint64{seq, seq}
+	}
+
+	if seq >= c.next {
+		c.next = seq + 1
+	}
+}
+
+// Missing returns the number of sequence numbers less than the largest
+// sequence number that were never seen.
+func (c *SequenceChecker) Missing() int64 {
+	return c.missing().Count
+}
+
+func (c *SequenceChecker) missing() SeqRanges {
+	m := SeqRanges{max: c.examples}
+	var next uint64
+	for _, rng := range c.seen {
+		if rng[0] > next {
+			m.AddRange(next, rng[0]-1)
+		}
+		next = rng[1] + 1
+	}
+	return m
+}
+
+func (c *SequenceChecker) Report(w io.Writer) {
+	fmt.Fprintf(w, "lines      %d\n", c.Lines)
+	if c.next > 0 {
+		fmt.Fprintf(w, "sequence   0-%d\n", c.next-1)
+	} else {
+		fmt.Fprintf(w, "sequence   none\n")
+	}
+	fmt.Fprintf(w, "missing    %s\n", c.missing())
+	fmt.Fprintf(w, "duplicated %s\n", c.Duplicated)
+	fmt.Fprintf(w, "reordered  %s\n", c.Reordered)
+	fmt.Fprintf(w, "malformed  %d\n", c.Malformed)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"reflect"
+)
+
+// Checkpoint is the state of a run saved with -checkpoint, from which an
+// interrupted run can resume with -resume. The random source is saved as the
+// seed and the number of values drawn from it; the rate shape follows from
+// the seed and the step.
+type Checkpoint struct {
+	Flags    map[string]string `json:"flags"`
+	Seed     int64             `json:"seed"`
+	Draws    uint64            `json:"draws"`
+	Step     int               `json:"step"`
+	Due      int               `json:"due"`
+	Slice    int               `json:"slice"`
+	Skips    int               `json:"skips"`
+	Tokens   float64           `json:"tokens,omitempty"`
+	Deferred int               `json:"deferred,omitempty"`
+	Pending  []byte            `json:"pending,omitempty"`
+	Sequence uint64            `json:"sequence,omitempty"`
+	ExitCode int               `json:"exit_code"`
+	Complete bool              `json:"complete"`
+	Stats    Stats             `json:"stats"`
+}
+
+// ReadCheckpoint reads a checkpoint from a file.
+func ReadCheckpoint(name string) (*Checkpoint, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var c Checkpoint
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint %s: %w", name, err)
+	}
+	return &c, nil
+}
+
+// Write saves the checkpoint to a file. The file is replaced atomically, so
+// it always holds a complete checkpoint.
+func (c *Checkpoint) Write(name string) error {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, append(b, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// Matches returns true if the checkpoint was saved by a run with the same
+// flags as fs, ignoring -resume.
+func (c *Checkpoint) Matches(fs *flag.FlagSet) bool {
+	return reflect.DeepEqual(c.Flags, checkpointFlags(fs))
+}
+
+// checkpointFlags returns the flags that were set in fs, except -resume.
+func checkpointFlags(fs *flag.FlagSet) map[string]string {
+	flags := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name != "resume" {
+			flags[f.Name] = f.Value.String()
+		}
+	})
+	return flags
+}
+
+// countingSource is a random source that counts the values drawn from it, so
+// that its state can be restored by drawing the same number of values from a
+// source with the same seed.
+type countingSource struct {
+	src rand.Source64
+	n   uint64
+}
+
+func newCountingSource(seed int64) *countingSource {
+	return &countingSource{src: rand.NewSource(seed).(rand.Source64)}
+}
+
+func (s *countingSource) Int63() int64 {
+	s.n++
+	return s.src.Int63()
+}
+
+func (s *countingSource) Uint64() uint64 {
+	s.n++
+	return s.src.Uint64()
+}
+
+func (s *countingSource) Seed(seed int64) {
+	s.src.Seed(seed)
+	s.n = 0
+}
+
+// Skip draws values until n values have been drawn in total.
+func (s *countingSource) Skip(n uint64) {
+	for s.n < n {
+		s.Int63()
+	}
+}
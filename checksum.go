@@ -0,0 +1,50 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"sync"
+)
+
+// StreamHash is a running SHA-256 hash of the bytes written through its
+// writers, in the order they were written. It is safe for concurrent use.
+type StreamHash struct {
+	mu sync.Mutex
+	h  hash.Hash
+	n  int64
+}
+
+func NewStreamHash() *StreamHash {
+	return &StreamHash{h: sha256.New()}
+}
+
+// Writer returns a writer that writes to w and adds the bytes that were
+// written to the hash. The lock is only held while hashing, so the hash
+// follows the order of the destination only if writes are not concurrent.
+func (s *StreamHash) Writer(w io.Writer) io.Writer {
+	return hashWriter{W: w, s: s}
+}
+
+// Sum returns the hash in hexadecimal and the number of bytes hashed.
+func (s *StreamHash) Sum() (string, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return hex.EncodeToString(s.h.Sum(nil)), s.n
+}
+
+type hashWriter struct {
+	W io.Writer
+	s *StreamHash
+}
+
+func (w hashWriter) Write(p []byte) (int, error) {
+	n, err := w.W.Write(p)
+
+	w.s.mu.Lock()
+	defer w.s.mu.Unlock()
+	w.s.h.Write(p[:n])
+	w.s.n += int64(n)
+	return n, err
+}
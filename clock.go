@@ -0,0 +1,64 @@
+package main
+
+import (
+	"math/rand"
+	"time"
+)
+
+// StepClock delivers a tick for each step. Ticks are scheduled at multiples
+// of the step size after the start time, each offset by a random amount up to
+// the jitter. Like time.Ticker, ticks missed because the receiver is slow are
+// dropped.
+type StepClock struct {
+	C <-chan time.Time
+
+	start  time.Time
+	size   time.Duration
+	jitter time.Duration
+	r      *rand.Rand
+
+	timer  *time.Timer
+	next   int
+	offset time.Duration
+}
+
+// NewStepClock creates a clock whose first tick is for the step with index
+// first.
+func NewStepClock(start time.Time, size, jitter time.Duration, r *rand.Rand, first int) *StepClock {
+	c := &StepClock{
+		start:  start,
+		size:   size,
+		jitter: jitter,
+		r:      r,
+		next:   first,
+	}
+	c.timer = time.NewTimer(c.schedule())
+	c.C = c.timer.C
+	return c
+}
+
+// Tick records that a tick was received at time t, schedules the next tick,
+// and returns the index of the latest step that was due at t.
+func (c *StepClock) Tick(t time.Time) int {
+	due := int(t.Add(-c.offset).Sub(c.start)/c.size) - 1
+	if due < c.next {
+		due = c.next
+	}
+
+	c.next = due + 1
+	c.timer.Reset(c.schedule())
+	return due
+}
+
+func (c *StepClock) Stop() {
+	c.timer.Stop()
+}
+
+// schedule picks the offset for the next tick and returns the time until it.
+func (c *StepClock) schedule() time.Duration {
+	c.offset = 0
+	if c.jitter > 0 {
+		c.offset = time.Duration(c.r.Int63n(int64(2*c.jitter)+1)) - c.jitter
+	}
+	return time.Until(c.start.Add(time.Duration(c.next+1)*c.size + c.offset))
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// ConcurrentOutput splits each write among several goroutines that write
+// their share of lines to their own writer at the same time. The writers
+// usually share the same underlying file, so lines from different goroutines
+// interleave; with small write sizes, individual lines are torn apart.
+type ConcurrentOutput struct {
+	writers []concurrentWriter
+	results chan writeResult
+}
+
+type concurrentWriter struct {
+	out  *RandomOutput
+	w    io.Writer
+	reqs chan int
+}
+
+type writeResult struct {
+	n   int
+	err error
+}
+
+// NewConcurrentOutput starts a goroutine for each output and writer pair.
+// Each goroutine writes at most writeSize bytes per call to its writer.
+func NewConcurrentOutput(outs []*RandomOutput, ws []io.Writer, writeSize int) *ConcurrentOutput {
+	c := &ConcurrentOutput{
+		writers: make([]concurrentWriter, len(outs)),
+		results: make(chan writeResult, len(outs)),
+	}
+	for i := range outs {
+		cw := concurrentWriter{
+			out:  outs[i],
+			w:    ChunkWriter{W: ws[i], Size: writeSize},
+			reqs: make(chan int),
+		}
+		c.writers[i] = cw
+		go cw.run(c.results)
+	}
+	return c
+}
+
+func (cw concurrentWriter) run(results chan<- writeResult) {
+	for n := range cw.reqs {
+		written, err := cw.out.WriteN(cw.w, n)
+		results <- writeResult{written, err}
+	}
+}
+
+// WriteN writes approximately n characters, divided evenly among the
+// writers, and returns after all writers finish.
+func (c *ConcurrentOutput) WriteN(n int) (written int, err error) {
+	return c.WriteShares(n, nil)
+}
+
+// WriteShares is like WriteN, but first gives each writer the number of
+// characters in the corresponding element of extra and divides the rest of n
+// evenly.
+func (c *ConcurrentOutput) WriteShares(n int, extra []int) (written int, err error) {
+	for _, e := range extra {
+		n -= e
+	}
+	if n < 0 {
+		n = 0
+	}
+
+	share, rem := n/len(c.writers), n%len(c.writers)
+	for i, cw := range c.writers {
+		req := share
+		if i < rem {
+			req++
+		}
+		if i < len(extra) {
+			req += extra[i]
+		}
+		cw.reqs <- req
+	}
+
+	for range c.writers {
+		res := <-c.results
+		written += res.n
+		if err == nil {
+			err = res.err
+		}
+	}
+	return written, err
+}
+
+// Close stops the writer goroutines.
+func (c *ConcurrentOutput) Close() {
+	for _, cw := range c.writers {
+		close(cw.reqs)
+	}
+}
+
+// ChunkWriter splits each write into multiple writes of at most Size bytes.
+// Chunks of UTF-8 text end between encoded characters when possible, so that
+// interleaved chunks do not tear characters apart.
+type ChunkWriter struct {
+	W    io.Writer
+	Size int
+}
+
+func (cw ChunkWriter) Write(p []byte) (written int, err error) {
+	for len(p) > 0 {
+		chunk := p[:chunkEnd(p, cw.Size)]
+
+		var n int
+		n, err = cw.W.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// chunkEnd returns the length of the first chunk of p, at most size bytes,
+// moved back to the start of an encoded character that would be split.
+func chunkEnd(p []byte, size int) int {
+	if len(p) <= size {
+		return len(p)
+	}
+	for i := size; i > 0 && size-i < utf8.UTFMax; i-- {
+		if utf8.RuneStart(p[i]) {
+			if !utf8.FullRune(p[i:size]) {
+				return i
+			}
+			break
+		}
+	}
+	return size
+}
+
+// WriterDecorator adds a tag identifying a concurrent writer to each line.
+func WriterDecorator(id int) LineDecorator {
+	tag := []byte(fmt.Sprintf("w%d ", id))
+	return func(prefix, suffix []byte) ([]byte, []byte) {
+		return append(prefix, tag...), suffix
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+
+package main
+
+import (
+	"io"
+	"os"
+)
+
+// enableEscapes enables ANSI escape sequences on a terminal, returning false
+// if the terminal does not support them.
+func enableEscapes(f *os.File) bool {
+	return true
+}
+
+// newOutputWriter returns a writer for output to f.
+func newOutputWriter(f *os.File) io.Writer {
+	return f
+}
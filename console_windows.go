@@ -0,0 +1,44 @@
+package main
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+const (
+	enableVirtualTerminalProcessing = 0x0004
+
+	// maxConsoleWrite limits the size of each write to a console. Large
+	// writes are slow to render and can fail when they exceed the console's
+	// internal buffers.
+	maxConsoleWrite = 8 * 1024
+)
+
+var procSetConsoleMode = syscall.NewLazyDLL("kernel32.dll").NewProc("SetConsoleMode")
+
+// enableEscapes enables ANSI escape sequences on a console, returning false
+// if f is not a console or the console does not support them.
+func enableEscapes(f *os.File) bool {
+	h := syscall.Handle(f.Fd())
+
+	var mode uint32
+	if err := syscall.GetConsoleMode(h, &mode); err != nil {
+		return false
+	}
+	if mode&enableVirtualTerminalProcessing != 0 {
+		return true
+	}
+
+	r, _, _ := procSetConsoleMode.Call(uintptr(h), uintptr(mode|enableVirtualTerminalProcessing))
+	return r != 0
+}
+
+// newOutputWriter returns a writer for output to f, splitting writes into
+// smaller chunks if f is a console.
+func newOutputWriter(f *os.File) io.Writer {
+	if !isTerminal(f) {
+		return f
+	}
+	return ChunkWriter{W: f, Size: maxConsoleWrite}
+}
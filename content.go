@@ -0,0 +1,338 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	ContentRandom     = "random"
+	ContentGraphite   = "graphite"
+	ContentPrometheus = "prometheus"
+	ContentJSON       = "json"
+	ContentStatsd     = "statsd"
+	ContentJournal    = "journal"
+	ContentAvro       = "avro"
+	ContentProtobuf   = "protobuf"
+	ContentJSONSchema = "json-schema"
+)
+
+const (
+	LengthPrefixVarint = "varint"
+	LengthPrefixUint32 = "uint32"
+)
+
+// contentOptions are the flags that select and configure generated content.
+type contentOptions struct {
+	content      string
+	metrics      int
+	metricPrefix string
+	metricLabels string
+	events       string
+	schema       string
+	schemaMsg    string
+	lengthPrefix string
+}
+
+func (o *contentOptions) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.content, "content", ContentRandom, "the content of each line, one of 'random', 'graphite', 'statsd', 'prometheus', 'json', 'journal', 'avro', 'protobuf', or 'json-schema'")
+	fs.IntVar(&o.metrics, "metrics", 1000, "number of distinct metric names; only used with metric content")
+	fs.StringVar(&o.metricPrefix, "metric-prefix", "rndout", "prefix for generated metric names; only used with metric content")
+	fs.StringVar(&o.metricLabels, "metric-labels", "", "comma-separated labels (e.g. 'env=ci,job=build') added to generated Prometheus series and, as tags, to statsd metrics")
+	fs.StringVar(&o.events, "events", "request=8,error=1,audit=1", "comma-separated event types, each with an optional relative weight, for JSON content; types are 'request', 'error', and 'audit'")
+	fs.StringVar(&o.schema, "schema", "", "Avro schema (JSON), .proto file, or JSON Schema describing the records; required for avro, protobuf, and json-schema content")
+	fs.StringVar(&o.schemaMsg, "schema-message", "", "name of the protobuf message to generate; if empty, use the first message in the schema")
+	fs.StringVar(&o.lengthPrefix, "length-prefix", LengthPrefixVarint, "length prefix of binary records, one of 'varint' or 'uint32' (big-endian)")
+}
+
+// binary returns true if the content is length-prefixed binary records.
+func (o *contentOptions) binary() bool {
+	return o.content == ContentAvro || o.content == ContentProtobuf
+}
+
+// lineEnding returns the line ending for the content. The journal export
+// format requires LF and binary records have no line endings.
+func (o *contentOptions) lineEnding(crlf bool) string {
+	switch {
+	case o.binary():
+		return ""
+	case crlf && o.content != ContentJournal:
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// newSource validates the options and returns the source of generated lines,
+// or nil for random content. Lines are at most blockSize characters when the
+// content allows it, JSON events are picked from mix, and timestamps in the
+// content come from clock.
+func (o *contentOptions) newSource(eol string, blockSize int, text TextFunc, mix *EventMix, clock func() time.Time) (LineSource, error) {
+	for _, l := range splitList(o.metricLabels) {
+		name, value, ok := strings.Cut(l, "=")
+		if !ok || !isLabelName(name) || strings.ContainsAny(value, "\"\\\n") {
+			return nil, fmt.Errorf("invalid metric label %q: must be name=value, where the value has no quotes or backslashes", l)
+		}
+	}
+	if o.metrics < 1 {
+		return nil, errors.New("invalid metrics: must be at least 1")
+	}
+
+	switch o.content {
+	case ContentRandom:
+		return nil, nil
+	case ContentGraphite:
+		return GraphiteSource{Names: MetricNames(o.metricPrefix, o.metrics), Clock: clock}, nil
+	case ContentStatsd:
+		var tags []string
+		for _, l := range splitList(o.metricLabels) {
+			tags = append(tags, strings.Replace(l, "=", ":", 1))
+		}
+		return StatsdSource{Names: MetricNames(o.metricPrefix, o.metrics), Tags: strings.Join(tags, ",")}, nil
+	case ContentPrometheus:
+		return PrometheusSource{Series: PrometheusSeries(o.metricPrefix, o.metrics, splitList(o.metricLabels)), Clock: clock}, nil
+	case ContentJSON:
+		return JSONSource{Mix: mix, LineSize: blockSize - len(eol), Text: text, Clock: clock}, nil
+	case ContentJournal:
+		return NewJournalSource(blockSize, text, clock), nil
+	case ContentAvro, ContentProtobuf:
+		if o.schema == "" {
+			return nil, errors.New("invalid content: binary records require -schema")
+		}
+		switch o.lengthPrefix {
+		case LengthPrefixVarint, LengthPrefixUint32:
+		default:
+			return nil, errors.New("invalid length prefix: must be one of 'varint' or 'uint32'")
+		}
+		var schema Record
+		var err error
+		if o.content == ContentAvro {
+			schema, err = ReadAvroSchema(o.schema)
+		} else {
+			schema, err = ReadProtoSchema(o.schema, o.schemaMsg)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return RecordSource{Record: schema, Prefix: o.lengthPrefix}, nil
+	case ContentJSONSchema:
+		if o.schema == "" {
+			return nil, errors.New("invalid content: json-schema records require -schema")
+		}
+		schema, err := ReadJSONSchema(o.schema)
+		if err != nil {
+			return nil, err
+		}
+		return JSONSchemaSource{Schema: schema}, nil
+	}
+	return nil, errors.New("invalid content: must be one of 'random', 'graphite', 'statsd', 'prometheus', 'json', 'journal', 'avro', 'protobuf', or 'json-schema'")
+}
+
+// maxGeneratedDepth limits how deeply generated records nest.
+const maxGeneratedDepth = 3
+
+// A LineSource generates the content of lines. Line appends the content of
+// one line, without the line ending, to dst and returns the extended slice.
+// Sources are shared by concurrent outputs, so they must only use r for
+// random decisions.
+type LineSource interface {
+	Line(dst []byte, r *rand.Rand) []byte
+}
+
+// An ErrorLineSource can also generate lines at an error level.
+type ErrorLineSource interface {
+	LineSource
+	ErrorLine(dst []byte, r *rand.Rand) []byte
+}
+
+// ErrorOverlay mixes error lines into the lines of a source. The fraction of
+// error lines changes as the run progresses, so that errors can follow a
+// different shape than the rest of the output. It is safe to share between
+// concurrent outputs.
+type ErrorOverlay struct {
+	Source ErrorLineSource
+
+	fraction uint64 // float64 bits
+}
+
+// SetFraction sets the probability that a line is an error line.
+func (o *ErrorOverlay) SetFraction(f float64) {
+	atomic.StoreUint64(&o.fraction, math.Float64bits(f))
+}
+
+func (o *ErrorOverlay) Line(dst []byte, r *rand.Rand) []byte {
+	if r.Float64() < math.Float64frombits(atomic.LoadUint64(&o.fraction)) {
+		return o.Source.ErrorLine(dst, r)
+	}
+	return o.Source.Line(dst, r)
+}
+
+var (
+	metricGroups = []string{"cpu", "memory", "disk", "network", "http", "db", "queue", "cache"}
+	metricNames  = []string{"count", "errors", "latency_ms", "bytes", "requests", "utilization"}
+)
+
+// metricSeries returns the host, group, and name of the i-th generated metric
+// series. Series are spread across hosts, groups, and names.
+func metricSeries(i int) (host, group, name string) {
+	perHost := len(metricGroups) * len(metricNames)
+	j := i % perHost
+	return fmt.Sprintf("host-%03d", i/perHost), metricGroups[j/len(metricNames)], metricNames[j%len(metricNames)]
+}
+
+// MetricNames returns n unique dotted metric names that start with prefix.
+func MetricNames(prefix string, n int) []string {
+	names := make([]string, n)
+	for i := range names {
+		host, group, name := metricSeries(i)
+		names[i] = host + "." + group + "." + name
+		if prefix != "" {
+			names[i] = prefix + "." + names[i]
+		}
+	}
+	return names
+}
+
+// PrometheusSeries returns n unique series in the Prometheus text format,
+// with names that start with prefix and a host label in addition to labels.
+// Label values must not contain quotes or backslashes.
+func PrometheusSeries(prefix string, n int, labels []string) []string {
+	var extra strings.Builder
+	for _, l := range labels {
+		name, value, _ := strings.Cut(l, "=")
+		fmt.Fprintf(&extra, `,%s="%s"`, name, value)
+	}
+
+	series := make([]string, n)
+	for i := range series {
+		host, group, name := metricSeries(i)
+		name = group + "_" + name
+		if prefix != "" {
+			name = prefix + "_" + name
+		}
+		series[i] = fmt.Sprintf(`%s{host="%s"%s}`, name, host, extra.String())
+	}
+	return series
+}
+
+// GraphiteSource generates metrics in the Graphite plaintext format, with a
+// random value for a random metric on each line, timestamped by Clock.
+type GraphiteSource struct {
+	Names []string
+	Clock func() time.Time
+}
+
+func (s GraphiteSource) Line(dst []byte, r *rand.Rand) []byte {
+	dst = append(dst, s.Names[r.Intn(len(s.Names))]...)
+	dst = append(dst, ' ')
+	dst = strconv.AppendFloat(dst, r.Float64()*100, 'f', 2, 64)
+	dst = append(dst, ' ')
+	return strconv.AppendInt(dst, s.Clock().Unix(), 10)
+}
+
+// StatsdSource generates metrics in the statsd format, with a random value
+// for a random metric on each line. Metrics are counters, gauges, or timers
+// depending on their names. If Tags is not empty, lines include them using
+// the DogStatsD tag extension.
+type StatsdSource struct {
+	Names []string
+	Tags  string
+}
+
+func (s StatsdSource) Line(dst []byte, r *rand.Rand) []byte {
+	name := s.Names[r.Intn(len(s.Names))]
+	dst = append(dst, name...)
+	dst = append(dst, ':')
+	switch {
+	case strings.HasSuffix(name, "_ms"):
+		dst = strconv.AppendFloat(dst, r.ExpFloat64()*50, 'f', 2, 64)
+		dst = append(dst, "|ms"...)
+	case strings.HasSuffix(name, ".utilization"):
+		dst = strconv.AppendFloat(dst, r.Float64()*100, 'f', 2, 64)
+		dst = append(dst, "|g"...)
+	default:
+		dst = strconv.AppendInt(dst, 1+r.Int63n(10), 10)
+		dst = append(dst, "|c"...)
+	}
+	if s.Tags != "" {
+		dst = append(dst, "|#"...)
+		dst = append(dst, s.Tags...)
+	}
+	return dst
+}
+
+// PrometheusSource generates samples in the Prometheus text format, with a
+// random value for a random series on each line, timestamped by Clock.
+type PrometheusSource struct {
+	Series []string
+	Clock  func() time.Time
+}
+
+func (s PrometheusSource) Line(dst []byte, r *rand.Rand) []byte {
+	dst = append(dst, s.Series[r.Intn(len(s.Series))]...)
+	dst = append(dst, ' ')
+	dst = strconv.AppendFloat(dst, r.Float64()*100, 'f', 2, 64)
+	dst = append(dst, ' ')
+	return strconv.AppendInt(dst, s.Clock().UnixNano()/1e6, 10)
+}
+
+// isLabelName returns true if s is a valid Prometheus label name.
+func isLabelName(s string) bool {
+	if s == "" || s[0] >= '0' && s[0] <= '9' {
+		return false
+	}
+	for _, c := range s {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// A Record generates random binary records, like Avro or protobuf messages.
+type Record interface {
+	Append(dst []byte, r *rand.Rand) []byte
+}
+
+// RecordSource generates length-prefixed binary records. The prefix is an
+// unsigned varint or a big-endian 32-bit integer. Records have no line
+// endings, so it must be used with an empty line ending.
+type RecordSource struct {
+	Record Record
+	Prefix string
+}
+
+func (s RecordSource) Line(dst []byte, r *rand.Rand) []byte {
+	rec := s.Record.Append(nil, r)
+	if s.Prefix == LengthPrefixUint32 {
+		n := uint32(len(rec))
+		dst = append(dst, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	} else {
+		dst = protoAppendVarint(dst, uint64(len(rec)))
+	}
+	return append(dst, rec...)
+}
+
+// JSONSchemaSource generates JSON records that conform to a JSON Schema.
+type JSONSchemaSource struct {
+	Schema *JSONSchema
+}
+
+func (s JSONSchemaSource) Line(dst []byte, r *rand.Rand) []byte {
+	return s.Schema.Append(dst, r)
+}
+
+// randomString returns a string of n random characters from the alphabet.
+func randomString(r *rand.Rand, n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = alphabet[r.Intn(len(alphabet))]
+	}
+	return string(b)
+}
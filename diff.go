@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"time"
+)
+
+func diffMain(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: rndout diff [flags] planned.csv measured.csv")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Compare two rate profiles and report the deviation, lag, and loss in each")
+		fmt.Fprintln(fs.Output(), "interval. Each file is a profile from 'rndout verify', a trace from 'rndout")
+		fmt.Fprintln(fs.Output(), "record', or a trace from -trace-file, which uses the planned bytes for each")
+		fmt.Fprintln(fs.Output(), "step.")
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+
+	interval := fs.Duration("interval", time.Second, "length of each comparison interval")
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *interval <= 0 {
+		die("invalid interval: must be greater than zero")
+	}
+
+	planned, err := readProfileFile(fs.Arg(0), *interval)
+	if err != nil {
+		die(err)
+	}
+	measured, err := readProfileFile(fs.Arg(1), *interval)
+	if err != nil {
+		die(err)
+	}
+
+	rows, summary := DiffProfiles(planned, measured, *interval)
+	if err := writeDiffCSV(os.Stdout, rows); err != nil {
+		die(err)
+	}
+
+	fmt.Fprintf(os.Stderr, "planned %d bytes, measured %d bytes, loss %d bytes (%.2f%%)\n", summary.Planned, summary.Measured, summary.Loss, summary.LossPercent)
+	fmt.Fprintf(os.Stderr, "mean absolute deviation %.1f bytes/interval, max lag %.3fs\n", summary.MeanAbsDeviation, summary.MaxLag)
+}
+
+// DiffRow compares one interval of two profiles. Lag is the time from the end
+// of the interval until the end of the first interval in which the measured
+// profile's cumulative bytes reached the planned cumulative bytes, or NaN if it
+// never did. Lag is never negative: if the measured profile was ahead, it is 0.
+type DiffRow struct {
+	Start       float64
+	Planned     int64
+	Measured    int64
+	CumPlanned  int64
+	CumMeasured int64
+	Deviation   int64
+	Lag         float64
+}
+
+type DiffSummary struct {
+	Planned          int64
+	Measured         int64
+	Loss             int64
+	LossPercent      float64
+	MeanAbsDeviation float64
+	MaxLag           float64
+}
+
+func DiffProfiles(planned, measured []int64, interval time.Duration) ([]DiffRow, DiffSummary) {
+	n := len(planned)
+	if len(measured) > n {
+		n = len(measured)
+	}
+
+	rows := make([]DiffRow, n)
+	for i := range rows {
+		r := &rows[i]
+		r.Start = (time.Duration(i) * interval).Seconds()
+		if i < len(planned) {
+			r.Planned = planned[i]
+		}
+		if i < len(measured) {
+			r.Measured = measured[i]
+		}
+		r.Deviation = r.Measured - r.Planned
+		if i > 0 {
+			r.CumPlanned = rows[i-1].CumPlanned
+			r.CumMeasured = rows[i-1].CumMeasured
+		}
+		r.CumPlanned += r.Planned
+		r.CumMeasured += r.Measured
+	}
+
+	// both cumulative totals only grow, so the interval that catches up
+	// with each planned total is never before the previous one
+	var s DiffSummary
+	var absDev int64
+	j := 0
+	for i := range rows {
+		r := &rows[i]
+		for j < n && rows[j].CumMeasured < r.CumPlanned {
+			j++
+		}
+		switch {
+		case j == n:
+			r.Lag = math.NaN()
+		case j < i:
+			r.Lag = 0
+		default:
+			r.Lag = (time.Duration(j-i) * interval).Seconds()
+		}
+		if r.Lag > s.MaxLag {
+			s.MaxLag = r.Lag
+		}
+		if r.Deviation < 0 {
+			absDev -= r.Deviation
+		} else {
+			absDev += r.Deviation
+		}
+	}
+
+	if n > 0 {
+		s.Planned = rows[n-1].CumPlanned
+		s.Measured = rows[n-1].CumMeasured
+		s.MeanAbsDeviation = float64(absDev) / float64(n)
+	}
+	s.Loss = s.Planned - s.Measured
+	if s.Planned > 0 {
+		s.LossPercent = 100 * float64(s.Loss) / float64(s.Planned)
+	}
+	return rows, s
+}
+
+// readProfileFile reads a profile or trace CSV and returns the bytes in each
+// interval.
+func readProfileFile(name string, interval time.Duration) ([]int64, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	p, err := ReadProfile(f, interval)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return p, nil
+}
+
+// ReadProfile reads a profile written by verify, a trace written by record,
+// or a trace written with -trace-file and returns the bytes in each interval.
+func ReadProfile(r io.Reader, interval time.Duration) ([]int64, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid profile: %w", err)
+	}
+
+	var offset func(rec []string) (time.Duration, error)
+	var bytesCol int
+
+	switch {
+	case len(header) == len(profileHeader) && header[0] == profileHeader[0]:
+		bytesCol = 1
+		offset = func(rec []string) (time.Duration, error) {
+			start, err := strconv.ParseFloat(rec[0], 64)
+			return time.Duration(start * float64(time.Second)), err
+		}
+
+	case len(header) == len(recordHeader) && header[0] == recordHeader[0] && header[1] == recordHeader[1]:
+		bytesCol = 2
+		offset = func(rec []string) (time.Duration, error) {
+			start, err := strconv.ParseFloat(rec[1], 64)
+			return time.Duration(start * float64(time.Second)), err
+		}
+
+	case len(header) == len(traceHeader) && header[0] == traceHeader[0]:
+		bytesCol = 2
+		var first time.Time
+		offset = func(rec []string) (time.Duration, error) {
+			t, err := time.Parse(time.RFC3339Nano, rec[1])
+			if first.IsZero() {
+				first = t
+			}
+			return t.Sub(first), err
+		}
+
+	default:
+		return nil, fmt.Errorf("invalid profile: unknown header %q", header)
+	}
+
+	var profile []int64
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return profile, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid profile: %w", err)
+		}
+		if len(rec) != len(header) {
+			return nil, fmt.Errorf("invalid profile: line has %d fields, expected %d", len(rec), len(header))
+		}
+
+		off, err := offset(rec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid profile: %w", err)
+		}
+		n, err := strconv.ParseInt(rec[bytesCol], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid profile: %w", err)
+		}
+
+		i := int(off / interval)
+		for len(profile) <= i {
+			profile = append(profile, 0)
+		}
+		profile[i] += n
+	}
+}
+
+func writeDiffCSV(w io.Writer, rows []DiffRow) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"start", "planned", "measured", "deviation", "cum_planned", "cum_measured", "lag"})
+	for _, r := range rows {
+		lag := ""
+		if !math.IsNaN(r.Lag) {
+			lag = strconv.FormatFloat(r.Lag, 'f', -1, 64)
+		}
+		cw.Write([]string{
+			strconv.FormatFloat(r.Start, 'f', -1, 64),
+			strconv.FormatInt(r.Planned, 10),
+			strconv.FormatInt(r.Measured, 10),
+			strconv.FormatInt(r.Deviation, 10),
+			strconv.FormatInt(r.CumPlanned, 10),
+			strconv.FormatInt(r.CumMeasured, 10),
+			lag,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"io"
+	"math/rand"
+	"time"
+)
+
+// DripWriter splits each write into fragments of 1 to MaxFragment bytes and
+// waits a random delay before writing each fragment, like interactive
+// terminal output or a very slow producer.
+type DripWriter struct {
+	W           io.Writer
+	MaxFragment int
+
+	// Delay is the mean delay before each fragment, and Dist is its
+	// distribution, one of the size distributions.
+	Delay time.Duration
+	Dist  string
+
+	r *rand.Rand
+}
+
+func NewDripWriter(w io.Writer, r *rand.Rand, maxFragment int, delay time.Duration, dist string) *DripWriter {
+	return &DripWriter{
+		W:           w,
+		MaxFragment: maxFragment,
+		Delay:       delay,
+		Dist:        dist,
+		r:           r,
+	}
+}
+
+func (dw *DripWriter) Write(p []byte) (written int, err error) {
+	for len(p) > 0 {
+		fragment := p
+		if n := 1 + dw.r.Intn(dw.MaxFragment); n < len(fragment) {
+			fragment = fragment[:n]
+		}
+		time.Sleep(time.Duration(randomAmount(dw.r, int64(dw.Delay), dw.Dist)))
+
+		var n int
+		n, err = dw.W.Write(fragment)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
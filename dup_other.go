@@ -0,0 +1,13 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package main
+
+import (
+	"os"
+)
+
+// dupFile returns f, as file descriptors cannot be duplicated on this
+// platform. Writes from concurrent writers are serialized by f.
+func dupFile(f *os.File) (*os.File, error) {
+	return f, nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// EventType generates the fields of one kind of event. Fields appends the
+// event's fields to dst.
+type EventType struct {
+	Name   string
+	Fields func(dst []EventField, r *rand.Rand) []EventField
+}
+
+// EventField is a named field of an event. The value is a string, an int64, a
+// float64, or a bool.
+type EventField struct {
+	Name  string
+	Value interface{}
+}
+
+var eventTypes = map[string]EventType{
+	"request": {"request", requestFields},
+	"error":   {"error", errorFields},
+	"audit":   {"audit", auditFields},
+}
+
+var (
+	httpMethods  = []string{"GET", "GET", "GET", "POST", "PUT", "DELETE"}
+	httpPaths    = []string{"/api/v1/items", "/api/v1/users", "/api/v1/orders", "/healthz", "/login"}
+	httpStatuses = []int64{200, 200, 200, 200, 201, 204, 304, 400, 404, 500, 503}
+	errorKinds   = []string{"connection refused", "timeout", "not found", "permission denied", "invalid argument"}
+	services     = []string{"api", "worker", "scheduler", "billing", "auth"}
+	auditActions = []string{"create", "read", "update", "delete", "login", "logout"}
+)
+
+func requestFields(dst []EventField, r *rand.Rand) []EventField {
+	return append(dst,
+		EventField{"method", httpMethods[r.Intn(len(httpMethods))]},
+		EventField{"path", httpPaths[r.Intn(len(httpPaths))]},
+		EventField{"status", httpStatuses[r.Intn(len(httpStatuses))]},
+		EventField{"duration_ms", math.Round(r.ExpFloat64()*5000) / 100},
+		EventField{"bytes", r.Int63n(1 << 16)},
+		EventField{"client_ip", "10." + strconv.FormatInt(r.Int63n(256), 10) + "." + strconv.FormatInt(r.Int63n(256), 10) + "." + strconv.FormatInt(r.Int63n(256), 10)},
+	)
+}
+
+func errorFields(dst []EventField, r *rand.Rand) []EventField {
+	return append(dst,
+		EventField{"level", "error"},
+		EventField{"service", services[r.Intn(len(services))]},
+		EventField{"error", errorKinds[r.Intn(len(errorKinds))]},
+		EventField{"code", "E" + strconv.FormatInt(1000+r.Int63n(9000), 10)},
+		EventField{"retryable", r.Intn(2) == 0},
+	)
+}
+
+func auditFields(dst []EventField, r *rand.Rand) []EventField {
+	return append(dst,
+		EventField{"user", "user-" + strconv.FormatInt(r.Int63n(1000), 10)},
+		EventField{"action", auditActions[r.Intn(len(auditActions))]},
+		EventField{"resource", "project/" + strconv.FormatInt(r.Int63n(100), 10)},
+		EventField{"success", r.Intn(10) != 0},
+	)
+}
+
+// appendJSONField appends a field, preceded by a comma, to a JSON object.
+// String values are not escaped.
+func appendJSONField(dst []byte, f EventField) []byte {
+	dst = append(dst, `,"`...)
+	dst = append(dst, f.Name...)
+	dst = append(dst, `":`...)
+	switch v := f.Value.(type) {
+	case string:
+		dst = append(dst, '"')
+		dst = append(dst, v...)
+		return append(dst, '"')
+	case int64:
+		return strconv.AppendInt(dst, v, 10)
+	case float64:
+		return strconv.AppendFloat(dst, v, 'f', 2, 64)
+	case bool:
+		return strconv.AppendBool(dst, v)
+	}
+	return dst
+}
+
+// EventMix is a set of event types with the probability of each. It is safe
+// to share between concurrent outputs, including while Set replaces it.
+type EventMix struct {
+	Types   []EventType
+	Weights []float64
+	total   float64
+
+	// replaced holds the *EventMix from the last call to Set
+	replaced atomic.Value
+}
+
+// Set replaces the types and weights of the mix with those of n.
+func (m *EventMix) Set(n *EventMix) {
+	m.replaced.Store(n)
+}
+
+// ParseEventMix parses a comma-separated list of event types with optional
+// weights, like 'request=8,error=1,audit=1'. Types without a weight have a
+// weight of 1.
+func ParseEventMix(s string) (*EventMix, error) {
+	mix := &EventMix{}
+	for _, e := range splitList(s) {
+		name, weight, hasWeight := strings.Cut(e, "=")
+		t, ok := eventTypes[name]
+		if !ok {
+			return nil, fmt.Errorf("invalid event type %q: must be one of 'request', 'error', or 'audit'", name)
+		}
+
+		w := 1.0
+		if hasWeight {
+			var err error
+			if w, err = strconv.ParseFloat(weight, 64); err != nil || w < 0 {
+				return nil, fmt.Errorf("invalid weight for event type %q: must be a non-negative number", name)
+			}
+		}
+
+		mix.Types = append(mix.Types, t)
+		mix.Weights = append(mix.Weights, w)
+		mix.total += w
+	}
+	if mix.total <= 0 {
+		return nil, fmt.Errorf("invalid event mix: must include at least one event type with a positive weight")
+	}
+	return mix, nil
+}
+
+func (m *EventMix) pick(r *rand.Rand) EventType {
+	if n, ok := m.replaced.Load().(*EventMix); ok {
+		m = n
+	}
+	x := r.Float64() * m.total
+	for i, w := range m.Weights {
+		if x < w {
+			return m.Types[i]
+		}
+		x -= w
+	}
+	return m.Types[len(m.Types)-1]
+}
+
+// JSONSource generates newline-delimited JSON events with types picked from
+// a mix. Each event has a timestamp from Clock, a type, the type's fields, and a message
+// of random text that pads the line to about LineSize characters.
+type JSONSource struct {
+	Mix      *EventMix
+	LineSize int
+	Text     TextFunc
+	Clock    func() time.Time
+}
+
+func (s JSONSource) Line(dst []byte, r *rand.Rand) []byte {
+	return s.line(dst, r, s.Mix.pick(r))
+}
+
+// ErrorLine generates an error event.
+func (s JSONSource) ErrorLine(dst []byte, r *rand.Rand) []byte {
+	return s.line(dst, r, eventTypes["error"])
+}
+
+func (s JSONSource) line(dst []byte, r *rand.Rand, t EventType) []byte {
+	start := len(dst)
+
+	dst = append(dst, `{"ts":"`...)
+	dst = s.Clock().UTC().AppendFormat(dst, "2006-01-02T15:04:05.000Z07:00")
+	dst = append(dst, `","type":"`...)
+	dst = append(dst, t.Name...)
+	dst = append(dst, '"')
+	for _, f := range t.Fields(nil, r) {
+		dst = appendJSONField(dst, f)
+	}
+
+	dst = append(dst, `,"message":"`...)
+	if n := s.LineSize - (len(dst) - start) - 2; n > 0 {
+		dst = append(dst, make([]byte, n)...)
+		s.Text(dst[len(dst)-n:], r)
+	}
+	return append(dst, `"}`...)
+}
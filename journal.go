@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+var journalPriorities = []int{6, 6, 6, 6, 6, 6, 5, 4, 3, 7}
+
+// JournalSource generates entries in the systemd journal export format. Each
+// entry is a block of fields ending with an empty line, which the output adds
+// as the line ending. About one in ten messages spans several lines and uses
+// the binary field encoding. Entries are timestamped by Clock, and the
+// monotonic timestamps count from its time when the source is created. It is
+// safe to share between concurrent outputs.
+type JournalSource struct {
+	// MessageSize is the approximate size of each MESSAGE field.
+	MessageSize int
+	Text        TextFunc
+	Clock       func() time.Time
+
+	start    time.Time
+	bootID   string
+	hostname string
+	pid      string
+	seq      uint64
+}
+
+func NewJournalSource(messageSize int, text TextFunc, clock func() time.Time) *JournalSource {
+	hostname, _ := os.Hostname()
+	start := clock()
+	return &JournalSource{
+		MessageSize: messageSize,
+		Text:        text,
+		Clock:       clock,
+		start:       start,
+		bootID:      fmt.Sprintf("%032x", start.UnixNano()),
+		hostname:    hostname,
+		pid:         strconv.Itoa(os.Getpid()),
+	}
+}
+
+func (s *JournalSource) Line(dst []byte, r *rand.Rand) []byte {
+	return s.line(dst, r, journalPriorities[r.Intn(len(journalPriorities))])
+}
+
+// ErrorLine generates an entry with the "err" priority.
+func (s *JournalSource) ErrorLine(dst []byte, r *rand.Rand) []byte {
+	return s.line(dst, r, 3)
+}
+
+func (s *JournalSource) line(dst []byte, r *rand.Rand, priority int) []byte {
+	seq := atomic.AddUint64(&s.seq, 1)
+	now := s.Clock()
+	realtime := uint64(now.UnixNano() / 1000)
+	monotonic := uint64(now.Sub(s.start) / time.Microsecond)
+
+	dst = append(dst, fmt.Sprintf("__CURSOR=s=%s;i=%x;b=%s;m=%x;t=%x;x=%x\n", s.bootID, seq, s.bootID, monotonic, realtime, seq)...)
+	dst = journalAppendField(dst, "__REALTIME_TIMESTAMP", strconv.FormatUint(realtime, 10))
+	dst = journalAppendField(dst, "__MONOTONIC_TIMESTAMP", strconv.FormatUint(monotonic, 10))
+	dst = journalAppendField(dst, "_BOOT_ID", s.bootID)
+	dst = journalAppendField(dst, "_TRANSPORT", "journal")
+	dst = journalAppendField(dst, "_HOSTNAME", s.hostname)
+	dst = journalAppendField(dst, "_PID", s.pid)
+	dst = journalAppendField(dst, "SYSLOG_IDENTIFIER", "rndout")
+	dst = journalAppendField(dst, "PRIORITY", strconv.Itoa(priority))
+
+	msg := make([]byte, s.MessageSize)
+	s.Text(msg, r)
+	if r.Intn(10) == 0 {
+		// break the message into lines of about 80 characters
+		for i := 80; i < len(msg); i += 80 {
+			msg[i] = '\n'
+		}
+	}
+	return journalAppendField(dst, "MESSAGE", string(msg))
+}
+
+// journalAppendField appends a field in the export format. Values that
+// contain newlines use the binary encoding: the name, a newline, the length
+// as a little-endian 64-bit integer, and the value.
+func journalAppendField(dst []byte, name, value string) []byte {
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\n' {
+			dst = append(dst, name...)
+			dst = append(dst, '\n')
+			var n [8]byte
+			binary.LittleEndian.PutUint64(n[:], uint64(len(value)))
+			dst = append(dst, n[:]...)
+			dst = append(dst, value...)
+			return append(dst, '\n')
+		}
+	}
+	dst = append(dst, name...)
+	dst = append(dst, '=')
+	dst = append(dst, value...)
+	return append(dst, '\n')
+}
@@ -0,0 +1,1101 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"reflect"
+	"regexp/syntax"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// JSONSchema is a parsed JSON Schema that can generate random values that
+// conform to it, encoded as JSON. It supports the type, enum, const,
+// properties, required, items, length, item count, and range keywords,
+// multipleOf, pattern, common formats, local $ref, allOf, anyOf, and oneOf.
+// Other keywords are ignored.
+type JSONSchema struct {
+	// Types are the allowed types; if empty, values are strings.
+	Types []string
+
+	// Enum holds the allowed values as JSON, from enum or const.
+	Enum [][]byte
+
+	// Variants are the alternatives from anyOf or oneOf, each merged with
+	// the rest of the schema.
+	Variants []*JSONSchema
+
+	Properties []JSONProperty // object
+	Items      *JSONSchema    // array
+	MinItems   int
+	MaxItems   int // -1 if unlimited
+
+	MinLength int // string
+	MaxLength int // -1 if unlimited
+	Pattern   *syntax.Regexp
+	Format    string
+
+	Minimum          float64 // number or integer
+	Maximum          float64
+	HasMinimum       bool
+	HasMaximum       bool
+	ExclusiveMinimum bool
+	ExclusiveMaximum bool
+	MultipleOf       float64
+
+	// recursive is true if references in the schema return to it, and height
+	// is the fewest nested arrays and objects in its values
+	recursive bool
+	height    int
+}
+
+// JSONProperty is a property of an object schema. Properties are sorted by
+// name so that generated objects are reproducible.
+type JSONProperty struct {
+	Name     string
+	Required bool
+	Schema   *JSONSchema
+}
+
+// ReadJSONSchema reads a JSON Schema from a file.
+func ReadJSONSchema(name string) (*JSONSchema, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, fmt.Errorf("invalid JSON Schema: %w", err)
+	}
+	p := jsonSchemaParser{root: v, nodes: make(map[uintptr]*JSONSchema)}
+	s, err := p.parse(v)
+	if err == nil {
+		err = s.limitRecursion()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON Schema: %w", err)
+	}
+	return s, nil
+}
+
+type jsonSchemaParser struct {
+	root interface{}
+
+	// nodes holds the schema parsed from each object in the document, by
+	// the object's identity. Recursive references reach the same objects
+	// again, so they refer to the schema being parsed instead of expanding
+	// it forever.
+	nodes map[uintptr]*JSONSchema
+}
+
+func (p *jsonSchemaParser) parse(v interface{}) (*JSONSchema, error) {
+	// plain references share the schema of their target
+	seen := make(map[string]bool)
+	for {
+		m, ok := v.(map[string]interface{})
+		if !ok || len(m) != 1 {
+			break
+		}
+		ref, ok := m["$ref"].(string)
+		if !ok {
+			break
+		}
+		if seen[ref] {
+			return nil, fmt.Errorf("circular reference %q", ref)
+		}
+		seen[ref] = true
+
+		var err error
+		if v, err = p.resolve(ref); err != nil {
+			return nil, err
+		}
+	}
+
+	switch v := v.(type) {
+	case bool:
+		if !v {
+			return nil, fmt.Errorf("schema false has no values")
+		}
+		return &JSONSchema{MaxItems: -1, MaxLength: -1}, nil
+	case map[string]interface{}:
+		key := reflect.ValueOf(v).Pointer()
+		if s, ok := p.nodes[key]; ok {
+			return s, nil
+		}
+		// register the schema first so that references in the object can
+		// refer to it
+		s := &JSONSchema{}
+		p.nodes[key] = s
+		t, err := p.parseObject(v)
+		if err != nil {
+			return nil, err
+		}
+		*s = *t
+		return s, nil
+	}
+	return nil, fmt.Errorf("invalid schema %v", v)
+}
+
+func (p *jsonSchemaParser) parseObject(m map[string]interface{}) (*JSONSchema, error) {
+	m, err := p.expand(m)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range []string{"oneOf", "anyOf"} {
+		subs, ok := m[key].([]interface{})
+		if !ok {
+			continue
+		}
+		rest := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			if k != key {
+				rest[k] = v
+			}
+		}
+
+		s := &JSONSchema{}
+		for _, sub := range subs {
+			sm, ok := sub.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s has an invalid schema", key)
+			}
+			if sm, err = p.expand(sm); err != nil {
+				return nil, err
+			}
+			vs, err := p.parseObject(mergeJSONSchemas(rest, sm))
+			if err != nil {
+				return nil, err
+			}
+			s.Variants = append(s.Variants, vs)
+		}
+		if len(s.Variants) == 0 {
+			return nil, fmt.Errorf("%s has no schemas", key)
+		}
+		return s, nil
+	}
+
+	s := &JSONSchema{MaxItems: -1, MaxLength: -1}
+	switch t := m["type"].(type) {
+	case string:
+		s.Types = []string{t}
+	case []interface{}:
+		for _, v := range t {
+			if str, ok := v.(string); ok {
+				s.Types = append(s.Types, str)
+			}
+		}
+	}
+	for _, t := range s.Types {
+		switch t {
+		case "null", "boolean", "integer", "number", "string", "array", "object":
+		default:
+			return nil, fmt.Errorf("unknown type %q", t)
+		}
+	}
+
+	if c, ok := m["const"]; ok {
+		b, _ := json.Marshal(c)
+		s.Enum = [][]byte{b}
+	} else if enum, ok := m["enum"].([]interface{}); ok {
+		for _, v := range enum {
+			b, _ := json.Marshal(v)
+			s.Enum = append(s.Enum, b)
+		}
+		if len(s.Enum) == 0 {
+			return nil, fmt.Errorf("enum has no values")
+		}
+	}
+
+	props, _ := m["properties"].(map[string]interface{})
+	required := make(map[string]bool)
+	if req, ok := m["required"].([]interface{}); ok {
+		for _, v := range req {
+			if name, ok := v.(string); ok {
+				required[name] = true
+				if _, ok := props[name]; !ok {
+					s.Properties = append(s.Properties, JSONProperty{Name: name, Required: true, Schema: &JSONSchema{MaxItems: -1, MaxLength: -1}})
+				}
+			}
+		}
+	}
+	for name, v := range props {
+		ps, err := p.parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("property %s: %w", name, err)
+		}
+		s.Properties = append(s.Properties, JSONProperty{Name: name, Required: required[name], Schema: ps})
+	}
+	sort.Slice(s.Properties, func(i, j int) bool { return s.Properties[i].Name < s.Properties[j].Name })
+
+	if items, ok := m["items"]; ok {
+		if _, ok := items.([]interface{}); ok {
+			return nil, fmt.Errorf("tuple items are not supported")
+		}
+		if s.Items, err = p.parse(items); err != nil {
+			return nil, err
+		}
+	}
+
+	number := func(key string) (float64, bool) {
+		v, ok := m[key].(float64)
+		return v, ok
+	}
+	if v, ok := number("minItems"); ok {
+		s.MinItems = int(v)
+	}
+	if v, ok := number("maxItems"); ok {
+		s.MaxItems = int(v)
+	}
+	if v, ok := number("minLength"); ok {
+		s.MinLength = int(v)
+	}
+	if v, ok := number("maxLength"); ok {
+		s.MaxLength = int(v)
+	}
+	s.Minimum, s.HasMinimum = number("minimum")
+	s.Maximum, s.HasMaximum = number("maximum")
+	// exclusive limits are numbers since draft 6 and flags before it
+	switch v := m["exclusiveMinimum"].(type) {
+	case float64:
+		s.Minimum, s.HasMinimum, s.ExclusiveMinimum = v, true, true
+	case bool:
+		s.ExclusiveMinimum = v
+	}
+	switch v := m["exclusiveMaximum"].(type) {
+	case float64:
+		s.Maximum, s.HasMaximum, s.ExclusiveMaximum = v, true, true
+	case bool:
+		s.ExclusiveMaximum = v
+	}
+	if v, ok := number("multipleOf"); ok && v > 0 {
+		s.MultipleOf = v
+	}
+
+	if pattern, ok := m["pattern"].(string); ok {
+		if s.Pattern, err = syntax.Parse(pattern, syntax.Perl); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	s.Format, _ = m["format"].(string)
+	if err := s.checkLength(); err != nil {
+		return nil, err
+	}
+
+	if len(s.Types) == 0 {
+		switch {
+		case len(s.Properties) > 0:
+			s.Types = []string{"object"}
+		case s.Items != nil:
+			s.Types = []string{"array"}
+		case s.HasMinimum || s.HasMaximum || s.MultipleOf > 0:
+			s.Types = []string{"number"}
+		}
+	}
+	return s, nil
+}
+
+// expand resolves a reference with other keywords and merges the schemas in
+// allOf into m.
+func (p *jsonSchemaParser) expand(m map[string]interface{}) (map[string]interface{}, error) {
+	seen := make(map[string]bool)
+	for {
+		ref, ok := m["$ref"].(string)
+		if !ok {
+			break
+		}
+		if seen[ref] {
+			return nil, fmt.Errorf("circular reference %q", ref)
+		}
+		seen[ref] = true
+		target, err := p.resolve(ref)
+		if err != nil {
+			return nil, err
+		}
+		tm, ok := target.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("reference %q is not a schema object", ref)
+		}
+		rest := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			if k != "$ref" {
+				rest[k] = v
+			}
+		}
+		m = mergeJSONSchemas(rest, tm)
+	}
+
+	all, ok := m["allOf"].([]interface{})
+	if !ok {
+		return m, nil
+	}
+	merged := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		if k != "allOf" {
+			merged[k] = v
+		}
+	}
+	for _, sub := range all {
+		sm, ok := sub.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("allOf has an invalid schema")
+		}
+		sm, err := p.expand(sm)
+		if err != nil {
+			return nil, err
+		}
+		merged = mergeJSONSchemas(merged, sm)
+	}
+	return merged, nil
+}
+
+// resolve returns the schema for a local reference, a JSON pointer like
+// "#/$defs/name".
+func (p *jsonSchemaParser) resolve(ref string) (interface{}, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("unsupported reference %q: only local references are supported", ref)
+	}
+
+	v := p.root
+	for _, part := range strings.Split(strings.TrimPrefix(ref[1:], "/"), "/") {
+		if part == "" {
+			continue
+		}
+		part = strings.NewReplacer("~1", "/", "~0", "~").Replace(part)
+		switch c := v.(type) {
+		case map[string]interface{}:
+			v = c[part]
+		case []interface{}:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(c) {
+				return nil, fmt.Errorf("invalid reference %q", ref)
+			}
+			v = c[i]
+		default:
+			v = nil
+		}
+		if v == nil {
+			return nil, fmt.Errorf("invalid reference %q", ref)
+		}
+	}
+	return v, nil
+}
+
+// mergeJSONSchemas returns a schema with the keywords of both a and b. The
+// properties and required names are combined; for other keywords, a wins.
+func mergeJSONSchemas(a, b map[string]interface{}) map[string]interface{} {
+	m := make(map[string]interface{}, len(a)+len(b))
+	for k, v := range a {
+		m[k] = v
+	}
+	for k, v := range b {
+		switch k {
+		case "properties":
+			props := make(map[string]interface{})
+			for _, src := range []interface{}{b[k], a[k]} {
+				sp, _ := src.(map[string]interface{})
+				for name, ps := range sp {
+					props[name] = ps
+				}
+			}
+			m[k] = props
+		case "required":
+			ar, _ := a[k].([]interface{})
+			br, _ := v.([]interface{})
+			m[k] = append(append([]interface{}(nil), ar...), br...)
+		default:
+			if _, ok := m[k]; !ok {
+				m[k] = v
+			}
+		}
+	}
+	return m
+}
+
+// limitRecursion checks that every schema in s can have a finite value, sets
+// the height of each schema, and marks the schemas that references return to.
+func (s *JSONSchema) limitRecursion() error {
+	var nodes []*JSONSchema
+	const (
+		walking = iota + 1
+		walked
+	)
+	state := make(map[*JSONSchema]int)
+	var walk func(*JSONSchema)
+	walk = func(s *JSONSchema) {
+		switch state[s] {
+		case walking:
+			s.recursive = true
+			return
+		case walked:
+			return
+		}
+		state[s] = walking
+		nodes = append(nodes, s)
+		for _, v := range s.Variants {
+			walk(v)
+		}
+		for _, p := range s.Properties {
+			walk(p.Schema)
+		}
+		if s.Items != nil {
+			walk(s.Items)
+		}
+		state[s] = walked
+	}
+	walk(s)
+
+	for _, n := range nodes {
+		n.height = math.MaxInt32
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, n := range nodes {
+			h := 0
+			switch {
+			case len(n.Variants) > 0:
+				h = math.MaxInt32
+				for _, v := range n.Variants {
+					if v.height < h {
+						h = v.height
+					}
+				}
+			case len(n.Enum) == 0 && len(n.Types) > 0:
+				h = n.typeHeight(n.lowestType())
+			}
+			if h < n.height {
+				n.height = h
+				changed = true
+			}
+		}
+	}
+
+	for _, n := range nodes {
+		if n.height == math.MaxInt32 {
+			return fmt.Errorf("schema always contains itself")
+		}
+	}
+	return nil
+}
+
+// typeHeight returns the fewest nested arrays and objects in a value of type
+// t, given the heights of the schemas in s.
+func (s *JSONSchema) typeHeight(t string) int {
+	h := 0
+	switch t {
+	case "array":
+		if s.MinItems > 0 && s.Items != nil {
+			h = s.Items.height
+		}
+	case "object":
+		for _, p := range s.Properties {
+			if p.Required && p.Schema.height > h {
+				h = p.Schema.height
+			}
+		}
+	default:
+		return 0
+	}
+	if h == math.MaxInt32 {
+		return h
+	}
+	return h + 1
+}
+
+// lowestType returns the first of the schema's types with the lowest height.
+func (s *JSONSchema) lowestType() string {
+	t := s.Types[0]
+	for _, u := range s.Types[1:] {
+		if s.typeHeight(u) < s.typeHeight(t) {
+			t = u
+		}
+	}
+	return t
+}
+
+// Append appends a random value that conforms to the schema, encoded as JSON.
+// Optional properties are included about half the time. Once a value has
+// followed references back to the same schemas a few times, it ends the
+// recursion as soon as it can, picking the variants and types with the fewest
+// nested values, only the required properties, and the fewest items.
+func (s *JSONSchema) Append(dst []byte, r *rand.Rand) []byte {
+	return s.append(dst, r, 0)
+}
+
+func (s *JSONSchema) append(dst []byte, r *rand.Rand, depth int) []byte {
+	if s.recursive {
+		depth++
+	}
+	stop := depth > maxGeneratedDepth
+
+	if len(s.Variants) > 0 {
+		if stop {
+			v := s.Variants[0]
+			for _, w := range s.Variants[1:] {
+				if w.height < v.height {
+					v = w
+				}
+			}
+			return v.append(dst, r, depth)
+		}
+		return s.Variants[r.Intn(len(s.Variants))].append(dst, r, depth)
+	}
+	if len(s.Enum) > 0 {
+		return append(dst, s.Enum[r.Intn(len(s.Enum))]...)
+	}
+
+	t := "string"
+	switch {
+	case len(s.Types) > 0 && stop:
+		t = s.lowestType()
+	case len(s.Types) > 0:
+		t = s.Types[r.Intn(len(s.Types))]
+	}
+	switch t {
+	case "null":
+		return append(dst, "null"...)
+	case "boolean":
+		return strconv.AppendBool(dst, r.Intn(2) == 0)
+	case "integer", "number":
+		return s.appendNumber(dst, r, t == "integer")
+	case "string":
+		return appendJSONString(dst, s.randomString(r))
+	case "array":
+		lo, hi := s.MinItems, s.MaxItems
+		if hi < 0 {
+			hi = lo + 4
+		}
+		if stop || hi < lo {
+			hi = lo
+		}
+		items := s.Items
+		if items == nil {
+			items = &JSONSchema{MaxItems: -1, MaxLength: -1}
+		}
+		dst = append(dst, '[')
+		for i, n := 0, lo+r.Intn(hi-lo+1); i < n; i++ {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			dst = items.append(dst, r, depth+1)
+		}
+		return append(dst, ']')
+	case "object":
+		dst = append(dst, '{')
+		first := true
+		for _, p := range s.Properties {
+			if !p.Required && (stop || r.Intn(2) == 0) {
+				continue
+			}
+			if !first {
+				dst = append(dst, ',')
+			}
+			first = false
+			dst = appendJSONString(dst, p.Name)
+			dst = append(dst, ':')
+			dst = p.Schema.append(dst, r, depth+1)
+		}
+		return append(dst, '}')
+	}
+	return dst
+}
+
+// appendNumber appends a random number within the schema's limits, which
+// default to 0 and 1000.
+func (s *JSONSchema) appendNumber(dst []byte, r *rand.Rand, integer bool) []byte {
+	lo, hi := 0.0, 1000.0
+	switch {
+	case s.HasMinimum && s.HasMaximum:
+		lo, hi = s.Minimum, s.Maximum
+	case s.HasMinimum:
+		lo, hi = s.Minimum, s.Minimum+1000
+	case s.HasMaximum:
+		lo, hi = s.Maximum-1000, s.Maximum
+	}
+
+	step := s.MultipleOf
+	switch {
+	case integer && step == 0:
+		step = 1
+	case integer && step != math.Trunc(step):
+		step = integerStep(step)
+	}
+	if step == 0 {
+		v := lo + r.Float64()*(hi-lo)
+		if rounded := math.Round(v*100) / 100; rounded > lo && rounded < hi {
+			v = rounded
+		}
+		if (s.ExclusiveMinimum && v <= lo) || (s.ExclusiveMaximum && v >= hi) {
+			v = (lo + hi) / 2
+		}
+		return strconv.AppendFloat(dst, v, 'f', -1, 64)
+	}
+
+	// pick a multiple of the step within the limits
+	first, last := math.Ceil(lo/step), math.Floor(hi/step)
+	if s.ExclusiveMinimum && first*step <= lo {
+		first++
+	}
+	if s.ExclusiveMaximum && last*step >= hi {
+		last--
+	}
+	k := first
+	if last > first {
+		k += float64(r.Int63n(int64(math.Min(last-first, 1<<62)) + 1))
+	}
+	if integer && step == math.Trunc(step) {
+		return strconv.AppendInt(dst, int64(k*step), 10)
+	}
+	// print the multiple with as many decimals as the step
+	decimals := -1
+	if str := strconv.FormatFloat(step, 'f', -1, 64); strings.Contains(str, ".") {
+		decimals = len(str) - strings.Index(str, ".") - 1
+	}
+	return strconv.AppendFloat(dst, k*step, 'f', decimals, 64)
+}
+
+// integerStep returns the smallest integer that is a multiple of step, which
+// is the numerator of step as a fraction in lowest terms.
+func integerStep(step float64) float64 {
+	decimals := 0
+	if str := strconv.FormatFloat(step, 'f', -1, 64); strings.Contains(str, ".") {
+		decimals = len(str) - strings.Index(str, ".") - 1
+	}
+	if decimals > 18 {
+		decimals = 18
+	}
+	num, den := int64(math.Round(step*math.Pow10(decimals))), int64(math.Pow10(decimals))
+	if num == 0 {
+		return 1
+	}
+	a, b := num, den
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return float64(num / a)
+}
+
+// timeLayouts are the layouts of the time formats, with each number of
+// fractional digits, for strings that must fit length limits.
+var timeLayouts = map[string][]string{
+	"date-time": {
+		"2006-01-02T15:04:05Z07:00",
+		"2006-01-02T15:04:05.0Z07:00",
+		"2006-01-02T15:04:05.00Z07:00",
+		"2006-01-02T15:04:05.000Z07:00",
+		"2006-01-02T15:04:05.000000Z07:00",
+		"2006-01-02T15:04:05.000000000Z07:00",
+	},
+	"date": {"2006-01-02"},
+	"time": {"15:04:05Z", "15:04:05.0Z", "15:04:05.00Z", "15:04:05.000Z"},
+}
+
+// ipv6Prefix starts generated IPv6 addresses, which are in the documentation
+// range.
+const ipv6Prefix = "2001:db8:"
+
+// checkLength returns an error if strings with the schema's pattern or format
+// can't be within its length limits.
+func (s *JSONSchema) checkLength() error {
+	if s.Pattern != nil {
+		if lo, hi := regexpLength(s.Pattern); !s.lengthsFit(lo, hi) {
+			return fmt.Errorf("pattern %s can't match a string with the length limits", s.Pattern)
+		}
+		return nil
+	}
+
+	fit := true
+	switch s.Format {
+	case "date-time", "date", "time":
+		fit = false
+		for _, layout := range timeLayouts[s.Format] {
+			n := len(time.Time{}.Format(layout))
+			fit = fit || s.lengthsFit(n, n)
+		}
+	case "email", "hostname":
+		fit = s.lengthsFit(len("@example.com")+1, -1)
+	case "uri", "url":
+		fit = s.lengthsFit(len("https://example.com/")+1, -1)
+	case "uuid":
+		fit = s.lengthsFit(36, 36)
+	case "ipv4":
+		fit = s.lengthsFit(len("0.0.0.0"), len("255.255.255.255"))
+	case "ipv6":
+		fit = s.lengthsFit(len(ipv6Prefix)+11, len(ipv6Prefix)+29)
+	}
+	if !fit {
+		return fmt.Errorf("format %s can't have the length limits", s.Format)
+	}
+	return nil
+}
+
+// lengthsFit returns true if a string from lo to hi characters long, where
+// hi is -1 if unlimited, can be within the schema's length limits.
+func (s *JSONSchema) lengthsFit(lo, hi int) bool {
+	return lengthsOverlap(lo, hi, s.MinLength, s.MaxLength)
+}
+
+// fits returns true if str is within the schema's length limits.
+func (s *JSONSchema) fits(str string) bool {
+	n := utf8.RuneCountInString(str)
+	return n >= s.MinLength && (s.MaxLength < 0 || n <= s.MaxLength)
+}
+
+// lengthIn returns a random length from lo to hi for the varying part of a
+// string with fixed other characters, moved to fit the schema's length limits.
+func (s *JSONSchema) lengthIn(r *rand.Rand, fixed, lo, hi int) int {
+	if n := s.MinLength - fixed; n > lo {
+		lo = n
+		if hi < lo {
+			hi = lo
+		}
+	}
+	if n := s.MaxLength - fixed; s.MaxLength >= 0 && n < hi {
+		hi = n
+		if lo > hi {
+			lo = hi
+		}
+	}
+	return lo + r.Intn(hi-lo+1)
+}
+
+// digitGroups returns n groups of 1 to max digits, after prefix and separated
+// by sep, with a length that fits the schema's limits. digits returns a random
+// number with the given number of digits.
+func (s *JSONSchema) digitGroups(r *rand.Rand, prefix, sep string, n, max int, digits func(int) string) string {
+	total := s.lengthIn(r, len(prefix)+(n-1)*len(sep), n, n*max)
+	sizes := make([]int, n)
+	for i := range sizes {
+		sizes[i] = 1
+	}
+	extra := total - n
+	if extra > n*(max-1) {
+		extra = n * (max - 1)
+	}
+	for extra > 0 {
+		if i := r.Intn(n); sizes[i] < max {
+			sizes[i]++
+			extra--
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(prefix)
+	for i, size := range sizes {
+		if i > 0 {
+			b.WriteString(sep)
+		}
+		b.WriteString(digits(size))
+	}
+	return b.String()
+}
+
+func (s *JSONSchema) randomString(r *rand.Rand) string {
+	if s.Pattern != nil {
+		return string(appendRegexpMatch(nil, s.Pattern, r, s.MinLength, s.MaxLength))
+	}
+
+	switch s.Format {
+	case "date-time", "date", "time":
+		// a time in the 2020s
+		t := time.Unix(1577836800+r.Int63n(10*365*86400), r.Int63n(1000)*1e6).UTC()
+		var str string
+		switch s.Format {
+		case "date":
+			str = t.Format("2006-01-02")
+		case "time":
+			str = t.Format("15:04:05Z")
+		default:
+			str = t.Format(time.RFC3339Nano)
+		}
+		// with length limits, try other numbers of fractional digits
+		for _, layout := range timeLayouts[s.Format] {
+			if s.fits(str) {
+				break
+			}
+			str = t.Format(layout)
+		}
+		return str
+	case "email":
+		return randomLower(r, s.lengthIn(r, len("@example.com"), 1, 12)) + "@example.com"
+	case "hostname":
+		return randomLower(r, s.lengthIn(r, len(".example.com"), 1, 12)) + ".example.com"
+	case "uri", "url":
+		return "https://example.com/" + randomLower(r, s.lengthIn(r, len("https://example.com/"), 1, 12))
+	case "uuid":
+		b := make([]byte, 16)
+		binary.BigEndian.PutUint64(b, r.Uint64())
+		binary.BigEndian.PutUint64(b[8:], r.Uint64())
+		b[6] = b[6]&0x0f | 0x40
+		b[8] = b[8]&0x3f | 0x80
+		return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+	case "ipv4":
+		str := fmt.Sprintf("%d.%d.%d.%d", r.Intn(256), r.Intn(256), r.Intn(256), r.Intn(256))
+		if !s.fits(str) {
+			str = s.digitGroups(r, "", ".", 4, 3, func(n int) string {
+				lo := []int{0, 10, 100}[n-1]
+				hi := []int{10, 100, 256}[n-1]
+				return strconv.Itoa(lo + r.Intn(hi-lo))
+			})
+		}
+		return str
+	case "ipv6":
+		str := fmt.Sprintf(ipv6Prefix+"%x:%x:%x:%x:%x:%x", r.Intn(65536), r.Intn(65536), r.Intn(65536), r.Intn(65536), r.Intn(65536), r.Intn(65536))
+		if !s.fits(str) {
+			str = s.digitGroups(r, ipv6Prefix, ":", 6, 4, func(n int) string {
+				lo := 0
+				if n > 1 {
+					lo = 1 << (4 * (n - 1))
+				}
+				return strconv.FormatInt(int64(lo+r.Intn(1<<(4*n)-lo)), 16)
+			})
+		}
+		return str
+	}
+
+	lo, hi := s.MinLength, s.MaxLength
+	if hi < 0 {
+		hi = lo + 31
+	}
+	if lo == 0 && hi > 0 {
+		lo = 1
+	}
+	if hi < lo {
+		hi = lo
+	}
+	return randomString(r, lo+r.Intn(hi-lo+1))
+}
+
+// randomLower returns a string of n random lowercase letters.
+func randomLower(r *rand.Rand, n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte('a' + r.Intn(26))
+	}
+	return string(b)
+}
+
+func appendJSONString(dst []byte, s string) []byte {
+	b, _ := json.Marshal(s)
+	return append(dst, b...)
+}
+
+// maxRegexpRepeat is the most extra repetitions of an unlimited repeat, like
+// x* or x+, in strings generated from a pattern.
+const maxRegexpRepeat = 8
+
+// appendRegexpMatch appends a random string that matches a regular
+// expression, with from lo to hi characters if it can, where hi is -1 if
+// unlimited. Anchors and word boundaries are ignored.
+func appendRegexpMatch(dst []byte, re *syntax.Regexp, r *rand.Rand, lo, hi int) []byte {
+	switch re.Op {
+	case syntax.OpLiteral:
+		for _, c := range re.Rune {
+			dst = utf8.AppendRune(dst, c)
+		}
+	case syntax.OpCharClass:
+		if c, ok := classRune(re.Rune, r); ok {
+			dst = utf8.AppendRune(dst, c)
+		}
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		dst = append(dst, alphabet[r.Intn(len(alphabet))])
+	case syntax.OpCapture:
+		dst = appendRegexpMatch(dst, re.Sub[0], r, lo, hi)
+	case syntax.OpConcat:
+		dst = appendRegexpSeq(dst, re.Sub, r, lo, hi)
+	case syntax.OpAlternate:
+		// pick from the alternatives that can fit
+		var fit []*syntax.Regexp
+		for _, sub := range re.Sub {
+			if min, max := regexpLength(sub); lengthsOverlap(min, max, lo, hi) {
+				fit = append(fit, sub)
+			}
+		}
+		if len(fit) == 0 {
+			fit = re.Sub
+		}
+		dst = appendRegexpMatch(dst, fit[r.Intn(len(fit))], r, lo, hi)
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		min, max := repeatCount(re)
+		subMin, subMax := regexpLength(re.Sub[0])
+
+		// repeat enough times to reach lo and few enough to stay within hi,
+		// going past the usual number of unlimited repeats if needed
+		nlo, nhi := min, max
+		if nhi < 0 {
+			nhi = min + maxRegexpRepeat
+		}
+		if lo > 0 && subMax != 0 {
+			n := 1
+			if subMax > 0 {
+				n = (lo + subMax - 1) / subMax
+			}
+			if n > nlo {
+				nlo = n
+			}
+			if max < 0 && nhi < nlo {
+				nhi = nlo
+			}
+		}
+		if hi >= 0 && subMin > 0 && hi/subMin < nhi {
+			nhi = hi / subMin
+		}
+		if nlo > nhi {
+			nlo, nhi = min, min
+		}
+
+		subs := make([]*syntax.Regexp, nlo+r.Intn(nhi-nlo+1))
+		for i := range subs {
+			subs[i] = re.Sub[0]
+		}
+		dst = appendRegexpSeq(dst, subs, r, lo, hi)
+	}
+	return dst
+}
+
+// appendRegexpSeq appends matches of each expression in subs, with from lo to
+// hi characters in total if it can. Each match leaves room for the rest.
+func appendRegexpSeq(dst []byte, subs []*syntax.Regexp, r *rand.Rand, lo, hi int) []byte {
+	// the fewest and most characters in the matches after each one
+	mins := make([]int, len(subs)+1)
+	maxs := make([]int, len(subs)+1)
+	for i := len(subs) - 1; i >= 0; i-- {
+		min, max := regexpLength(subs[i])
+		mins[i], maxs[i] = mins[i+1]+min, maxs[i+1]+max
+		if max < 0 || maxs[i+1] < 0 {
+			maxs[i] = -1
+		}
+	}
+
+	used := 0
+	for i, sub := range subs {
+		sublo, subhi := 0, -1
+		if maxs[i+1] >= 0 && lo-used-maxs[i+1] > 0 {
+			sublo = lo - used - maxs[i+1]
+		}
+		if hi >= 0 {
+			if subhi = hi - used - mins[i+1]; subhi < 0 {
+				subhi = 0
+			}
+		}
+		start := len(dst)
+		dst = appendRegexpMatch(dst, sub, r, sublo, subhi)
+		used += utf8.RuneCount(dst[start:])
+	}
+	return dst
+}
+
+// regexpLength returns the fewest and most characters in a match of a regular
+// expression, where the most is -1 if unlimited.
+func regexpLength(re *syntax.Regexp) (int, int) {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return len(re.Rune), len(re.Rune)
+	case syntax.OpCharClass, syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return 1, 1
+	case syntax.OpCapture:
+		return regexpLength(re.Sub[0])
+	case syntax.OpConcat:
+		lo, hi := 0, 0
+		for _, sub := range re.Sub {
+			min, max := regexpLength(sub)
+			lo += min
+			if max < 0 || hi < 0 {
+				hi = -1
+			} else {
+				hi += max
+			}
+		}
+		return lo, hi
+	case syntax.OpAlternate:
+		lo, hi := regexpLength(re.Sub[0])
+		for _, sub := range re.Sub[1:] {
+			min, max := regexpLength(sub)
+			if min < lo {
+				lo = min
+			}
+			if max < 0 || hi >= 0 && max > hi {
+				hi = max
+			}
+		}
+		return lo, hi
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		min, max := repeatCount(re)
+		subMin, subMax := regexpLength(re.Sub[0])
+		switch {
+		case subMax == 0:
+			return 0, 0
+		case max < 0 || subMax < 0:
+			return min * subMin, -1
+		}
+		return min * subMin, max * subMax
+	}
+	return 0, 0
+}
+
+// repeatCount returns the fewest and most repeats of a repeat operator, where
+// the most is -1 if unlimited.
+func repeatCount(re *syntax.Regexp) (int, int) {
+	switch re.Op {
+	case syntax.OpStar:
+		return 0, -1
+	case syntax.OpPlus:
+		return 1, -1
+	case syntax.OpQuest:
+		return 0, 1
+	}
+	return re.Min, re.Max
+}
+
+// lengthsOverlap returns true if the lengths from lo1 to hi1 and from lo2 to
+// hi2 overlap, where a hi of -1 is unlimited.
+func lengthsOverlap(lo1, hi1, lo2, hi2 int) bool {
+	return (hi2 < 0 || lo1 <= hi2) && (hi1 < 0 || hi1 >= lo2)
+}
+
+// classRune picks a random rune from a character class, given as pairs of
+// rune ranges. Printable ASCII characters are preferred if the class has any.
+func classRune(ranges []rune, r *rand.Rand) (rune, bool) {
+	for _, limit := range [][2]rune{{' ', '~'}, {0, unicode.MaxRune}} {
+		clip := func(i int) (rune, rune) {
+			lo, hi := ranges[i], ranges[i+1]
+			if lo < limit[0] {
+				lo = limit[0]
+			}
+			if hi > limit[1] {
+				hi = limit[1]
+			}
+			return lo, hi
+		}
+
+		total := 0
+		for i := 0; i+1 < len(ranges); i += 2 {
+			if lo, hi := clip(i); lo <= hi {
+				total += int(hi-lo) + 1
+			}
+		}
+		if total == 0 {
+			continue
+		}
+		k := rune(r.Intn(total))
+		for i := 0; i+1 < len(ranges); i += 2 {
+			lo, hi := clip(i)
+			if lo > hi {
+				continue
+			}
+			if k <= hi-lo {
+				return lo + k, true
+			}
+			k -= hi - lo + 1
+		}
+	}
+	return 0, false
+}
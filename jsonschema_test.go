@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// readTestJSONSchema parses a JSON Schema given as a string.
+func readTestJSONSchema(t *testing.T, schema string) (*JSONSchema, error) {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "schema.json")
+	if err := os.WriteFile(name, []byte(schema), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return ReadJSONSchema(name)
+}
+
+// generateJSON parses a schema and returns n values generated from it.
+func generateJSON(t *testing.T, schema string, n int) []interface{} {
+	t.Helper()
+	s, err := readTestJSONSchema(t, schema)
+	if err != nil {
+		t.Fatalf("invalid schema: %v", err)
+	}
+	r := rand.New(rand.NewSource(1))
+	values := make([]interface{}, n)
+	for i := range values {
+		b := s.Append(nil, r)
+		if err := json.Unmarshal(b, &values[i]); err != nil {
+			t.Fatalf("invalid JSON %s: %v", b, err)
+		}
+	}
+	return values
+}
+
+func TestJSONSchemaDeepNesting(t *testing.T) {
+	// ten levels of required objects, with an integer at the bottom
+	schema := `{"type": "integer"}`
+	for i := 0; i < 10; i++ {
+		schema = `{"type": "object", "required": ["a"], "properties": {"a": ` + schema + `}}`
+	}
+
+	for _, v := range generateJSON(t, schema, 20) {
+		for i := 0; i < 10; i++ {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				t.Fatalf("level %d is %v, want an object", i, v)
+			}
+			v = m["a"]
+		}
+		if _, ok := v.(float64); !ok {
+			t.Fatalf("bottom is %v, want an integer", v)
+		}
+	}
+}
+
+func TestJSONSchemaRecursion(t *testing.T) {
+	schema := `{
+		"$defs": {
+			"node": {
+				"type": "object",
+				"required": ["kids", "next"],
+				"properties": {
+					"kids": {"type": "array", "items": {"$ref": "#/$defs/node"}},
+					"next": {"anyOf": [{"$ref": "#/$defs/node", "description": "next node"}, {"type": "integer"}]}
+				}
+			}
+		},
+		"$ref": "#/$defs/node"
+	}`
+
+	var check func(v interface{}, depth int)
+	check = func(v interface{}, depth int) {
+		if depth > 20 {
+			t.Fatalf("value nests more than %d levels", depth)
+		}
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			t.Fatalf("node is %v, want an object", v)
+		}
+		kids, ok := m["kids"].([]interface{})
+		if !ok {
+			t.Fatalf("kids is %v, want an array", m["kids"])
+		}
+		for _, k := range kids {
+			check(k, depth+1)
+		}
+		if _, ok := m["next"].(float64); !ok {
+			check(m["next"], depth+1)
+		}
+	}
+	for _, v := range generateJSON(t, schema, 50) {
+		check(v, 0)
+	}
+
+	_, err := readTestJSONSchema(t, `{"type": "object", "required": ["self"], "properties": {"self": {"$ref": "#"}}}`)
+	if err == nil {
+		t.Errorf("schema that always contains itself was accepted")
+	}
+}
+
+func TestJSONSchemaStringLength(t *testing.T) {
+	tests := []struct {
+		schema string
+		valid  func(string) bool
+	}{
+		{`{"pattern": "^[a-z]+$", "minLength": 20, "maxLength": 25}`, regexp.MustCompile(`^[a-z]+$`).MatchString},
+		{`{"pattern": "^(ab|cde)*x$", "maxLength": 6}`, regexp.MustCompile(`^(ab|cde)*x$`).MatchString},
+		{`{"pattern": "^[0-9]{2,10}$", "minLength": 9}`, regexp.MustCompile(`^[0-9]{2,10}$`).MatchString},
+		{`{"format": "email", "maxLength": 15}`, func(s string) bool { return strings.HasSuffix(s, "@example.com") }},
+		{`{"format": "hostname", "minLength": 40}`, func(s string) bool { return strings.HasSuffix(s, ".example.com") }},
+		{`{"format": "ipv4", "minLength": 15}`, func(s string) bool { return net.ParseIP(s).To4() != nil }},
+		{`{"format": "ipv4", "maxLength": 8}`, func(s string) bool { return net.ParseIP(s).To4() != nil }},
+		{`{"format": "ipv6", "maxLength": 22}`, func(s string) bool { return net.ParseIP(s) != nil }},
+		{`{"format": "date-time", "maxLength": 20}`, func(s string) bool {
+			_, err := time.Parse(time.RFC3339, s)
+			return err == nil
+		}},
+		{`{"format": "time", "minLength": 13}`, func(s string) bool {
+			_, err := time.Parse("15:04:05Z", s)
+			return err == nil
+		}},
+	}
+
+	for _, test := range tests {
+		var limits struct {
+			MinLength int  `json:"minLength"`
+			MaxLength *int `json:"maxLength"`
+		}
+		if err := json.Unmarshal([]byte(test.schema), &limits); err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range generateJSON(t, test.schema, 200) {
+			s := v.(string)
+			n := utf8.RuneCountInString(s)
+			if n < limits.MinLength || limits.MaxLength != nil && n > *limits.MaxLength {
+				t.Errorf("%s: %q has the wrong length", test.schema, s)
+			}
+			if !test.valid(s) {
+				t.Errorf("%s: %q is invalid", test.schema, s)
+			}
+		}
+	}
+
+	for _, schema := range []string{
+		`{"format": "uuid", "maxLength": 10}`,
+		`{"format": "ipv4", "minLength": 16}`,
+		`{"format": "date-time", "maxLength": 21, "minLength": 21}`,
+		`{"pattern": "^a{3}$", "maxLength": 2}`,
+	} {
+		if _, err := readTestJSONSchema(t, schema); err == nil {
+			t.Errorf("%s: impossible length limits were accepted", schema)
+		}
+	}
+}
+
+func TestJSONSchemaIntegerMultipleOf(t *testing.T) {
+	tests := []struct {
+		multipleOf float64
+		step       float64
+	}{
+		{0.5, 1},
+		{2.5, 5},
+		{0.3, 3},
+		{1.2, 6},
+	}
+
+	for _, test := range tests {
+		b, _ := json.Marshal(map[string]interface{}{"type": "integer", "multipleOf": test.multipleOf, "minimum": 0, "maximum": 100})
+		for _, v := range generateJSON(t, string(b), 100) {
+			f := v.(float64)
+			if f != math.Trunc(f) || math.Mod(f, test.step) != 0 {
+				t.Errorf("multipleOf %v: %v is not a multiple of %v", test.multipleOf, f, test.step)
+			}
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"text/template"
+)
+
+// Sequence numbers lines, starting from Next. It is safe to share between
+// concurrent outputs.
+type Sequence struct {
+	// Next is the number of the next line. It must be accessed atomically
+	// once the decorator is in use.
+	Next uint64
+}
+
+// Decorator returns a decorator that prefixes each line with its sequence
+// number followed by a space.
+func (s *Sequence) Decorator() LineDecorator {
+	return func(prefix, suffix []byte) ([]byte, []byte) {
+		seq := atomic.AddUint64(&s.Next, 1) - 1
+		prefix = strconv.AppendUint(prefix, seq, 10)
+		prefix = append(prefix, ' ')
+		return prefix, suffix
+	}
+}
+
+// SequenceDecorator prefixes each line with an increasing sequence number,
+// starting from zero, followed by a space. The decorator is safe to share
+// between concurrent outputs.
+func SequenceDecorator() LineDecorator {
+	return new(Sequence).Decorator()
+}
+
+// TagDecorator adds fixed text to the start and end of each line.
+func TagDecorator(start, end string) LineDecorator {
+	return func(prefix, suffix []byte) ([]byte, []byte) {
+		return append(prefix, start...), append(suffix, end...)
+	}
+}
+
+// ExpandTag replaces {pid} with the process ID, {host} with the host name,
+// and {writer} with the writer number in a tag.
+func ExpandTag(tag string, writer int) string {
+	host, _ := os.Hostname()
+	return strings.NewReplacer(
+		"{pid}", strconv.Itoa(os.Getpid()),
+		"{host}", host,
+		"{writer}", strconv.Itoa(writer),
+	).Replace(tag)
+}
+
+// ParseFrame parses a header or footer template. In the template, the json
+// function encodes a value as JSON.
+func ParseFrame(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// RenderFrame executes a header or footer template with a stats record and
+// adds a line ending if the result does not end with one.
+func RenderFrame(tmpl *template.Template, rec StatsRecord, eol string) ([]byte, error) {
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, rec); err != nil {
+		return nil, err
+	}
+	if b.Len() > 0 && !bytes.HasSuffix(b.Bytes(), []byte("\n")) {
+		b.WriteString(eol)
+	}
+	return b.Bytes(), nil
+}
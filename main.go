@@ -1,73 +1,571 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
 	"io"
 	"math"
 	"math/rand"
 	"os"
+	"os/signal"
+	"runtime"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"text/template"
 	"time"
+	"unicode/utf8"
 )
 
 const (
 	alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789.- "
 )
 
+const (
+	exitWriteErrors = 3
+	exitPaused      = 4
+	exitAborted     = 5
+	exitInterrupted = 130
+	exitClosedPipe  = 141
+)
+
 const (
 	LogisticMode = "logistic"
 	RampMode     = "ramp"
+	SeasonalMode = "seasonal"
+	ReplayMode   = "replay"
+)
+
+const (
+	BlockedStretch = "stretch"
+	BlockedDrop    = "drop"
+	BlockedCatchUp = "catch-up"
+)
+
+const (
+	RateUnitBytes = "bytes"
+	RateUnitRunes = "runes"
+	RateUnitSpans = "spans"
+)
+
+const (
+	ExcessDefer = "defer"
+	ExcessDrop  = "drop"
+)
+
+const (
+	OnErrorContinue = "continue"
+	OnErrorAbort    = "abort"
+	OnErrorPause    = "pause"
 )
 
+// sinkTimeout limits each connection, request, and write of the network sinks
+const sinkTimeout = 30 * time.Second
+
 var opts struct {
-	peakRate string
-	mode     string
+	shapeOptions
+
 	skips    int
 	skipProb float64
 
-	duration  time.Duration
-	stepSize  time.Duration
 	sliceLen  int
 	blockSize int
+	sequence  bool
+	crlf      bool
+	seed      int64
+	timestamp string
+	prefix    string
+	suffix    string
+	header    string
+	footer    string
+
+	checksumTrailer bool
+	checksumFile    string
+
+	clockDrift        float64
+	clockStepInterval time.Duration
+	clockStepSize     time.Duration
+
+	jitter    time.Duration
+	writers   int
+	writeSize int
+
+	rateUnit string
+
+	drip         time.Duration
+	dripDist     string
+	dripFragment int
 
-	// logistic flags
-	scale int
+	incident      time.Duration
+	incidentLag   time.Duration
+	incidentRate  string
+	incidentScale int
 
-	// ramp flags
-	rampDuration time.Duration
+	contentOptions
+	text       string
+	errorRate  string
+	errorMode  string
+	errorPeak  time.Duration
+	errorScale int
+
+	webhookURL      string
+	webhookTemplate string
+	webhookHeaders  listFlag
+
+	remoteWriteURL     string
+	remoteWriteHeaders listFlag
+
+	redisAddr     string
+	redisKey      string
+	redisMaxLen   int64
+	redisPipeline int
+
+	mqtt MQTTOptions
+
+	udpAddr       string
+	udpPacketSize int
+
+	otlpURL      string
+	otlpHeaders  listFlag
+	otlpResource string
+	otlpScope    string
+	otlpTraces   string
+	otlpProtocol string
+	spanDepth    int
+	spanFanout   int
+	spanDuration time.Duration
+
+	tar         bool
+	tarFiles    int
+	tarFileSize string
+	tarSizeDist string
+
+	onError         string
+	retries         int
+	blocked         string
+	tokenBucket     string
+	maxBurst        string
+	burstExcess     string
+	retryBackoff    time.Duration
+	retryMaxBackoff time.Duration
+
+	checkpoint         string
+	checkpointInterval time.Duration
+	resume             bool
+
+	watch string
+
+	// plan is set by the plan command
+	plan bool
+
+	// stats flags
+	statsdAddr     string
+	statsdPrefix   string
+	statsdTags     string
+	statsdInterval time.Duration
+	statsFD        int
+	statsFile      string
+	statsInterval  time.Duration
+	tui            bool
+	progress       bool
+	traceFile      string
 }
 
 func init() {
-	flag.StringVar(&opts.peakRate, "rate", "128", "peak character rate in chars/s")
-	flag.StringVar(&opts.mode, "mode", LogisticMode, "the operation mode, one of 'logistic' or 'ramp'")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: rndout [flags]")
+		fmt.Fprintln(flag.CommandLine.Output(), "       rndout <command> [flags] [args]")
+		fmt.Fprintln(flag.CommandLine.Output())
+		fmt.Fprintln(flag.CommandLine.Output(), "Commands:")
+		fmt.Fprintln(flag.CommandLine.Output(), "  check     check sequence numbers in a stream for loss and duplication")
+		fmt.Fprintln(flag.CommandLine.Output(), "  diff      compare a planned and a measured rate profile")
+		fmt.Fprintln(flag.CommandLine.Output(), "  parquet   write generated events to a Parquet file")
+		fmt.Fprintln(flag.CommandLine.Output(), "  plan      print the expected totals of a run without running it")
+		fmt.Fprintln(flag.CommandLine.Output(), "  record    record the rate of a live stream as a trace")
+		fmt.Fprintln(flag.CommandLine.Output(), "  rotate    write a set of already rotated log files")
+		fmt.Fprintln(flag.CommandLine.Output(), "  throttle  copy stdin to stdout at a shaped rate")
+		fmt.Fprintln(flag.CommandLine.Output(), "  verify    measure the rate profile of a stream")
+		fmt.Fprintln(flag.CommandLine.Output(), "  wrap      run a command and shape the rate of its output")
+		fmt.Fprintln(flag.CommandLine.Output())
+		fmt.Fprintln(flag.CommandLine.Output(), "Flags:")
+		flag.PrintDefaults()
+	}
+
+	opts.shapeOptions.addFlags(flag.CommandLine)
 
 	flag.IntVar(&opts.skips, "skips", 2, "expected number of time steps with no output per slice")
 	flag.Float64Var(&opts.skipProb, "skip-probability", 0, "probability that a given slice will contain skips")
 
-	flag.DurationVar(&opts.duration, "duration", 60*time.Second, "duration")
-	flag.DurationVar(&opts.stepSize, "step-size", 250*time.Millisecond, "length of each time step")
+	flag.DurationVar(&opts.jitter, "jitter", 0, "maximum random offset from the nominal time of each step; must be less than half the step size")
 	flag.IntVar(&opts.sliceLen, "slice-length", 16, "number of time steps per slice")
 	flag.IntVar(&opts.blockSize, "block-size", 4096, "maximum number of characters printed in one line/operation")
+	flag.Int64Var(&opts.seed, "seed", 0, "seed for all random decisions; if 0, use the current time")
+	flag.IntVar(&opts.writers, "writers", 1, "number of concurrent writers sharing stdout; with more than one, lines from different writers interleave")
+	flag.IntVar(&opts.writeSize, "write-size", 64, "maximum bytes per write for concurrent writers; only used with -writers")
+	flag.StringVar(&opts.rateUnit, "rate-unit", RateUnitBytes, "what -rate and the other rates and limits count, one of 'bytes', 'runes' (UTF-8 encoded characters), or 'spans' (with -otlp-traces); stats always count bytes")
+	flag.DurationVar(&opts.drip, "drip", 0, "mean delay before writing each fragment of output, to drip output like slow typing; if 0, write each step's output at once")
+	flag.StringVar(&opts.dripDist, "drip-dist", SizeDistExponential, "distribution of the delays between fragments, one of 'fixed', 'uniform', or 'exponential'; only used with -drip")
+	flag.IntVar(&opts.dripFragment, "drip-fragment", 1, "maximum bytes in each fragment; fragment sizes are uniform from 1 to this size; only used with -drip")
+	flag.DurationVar(&opts.incident, "incident", 0, "time after the start of a shared incident that makes each writer burst; if 0, there is no incident")
+	flag.DurationVar(&opts.incidentLag, "incident-lag", 0, "delay between the bursts of successive writers during an incident")
+	flag.StringVar(&opts.incidentRate, "incident-rate", "1k", "peak rate of each writer's burst in chars/s, added to its share of -rate; only used with -incident")
+	flag.IntVar(&opts.incidentScale, "incident-scale", 8, "scale factor for the length of each burst, like -scale; only used with -incident")
+	opts.contentOptions.addFlags(flag.CommandLine)
+	flag.StringVar(&opts.text, "text", TextUniform, "the random text in lines and messages, one of 'uniform' characters or 'english' word-like text")
+	flag.StringVar(&opts.errorRate, "error-rate", "0", "peak rate of additional error lines in chars/s, shaped independently of -rate; only used with json and journal content")
+	flag.StringVar(&opts.errorMode, "error-mode", LogisticMode, "the shape of the error rate, one of 'logistic' or 'ramp'; only used with -error-rate")
+	flag.DurationVar(&opts.errorPeak, "error-peak", 0, "time of the peak error rate with -error-mode=logistic, or time taken to reach it with -error-mode=ramp; if 0, use half the duration")
+	flag.IntVar(&opts.errorScale, "error-scale", 25, "scale factor for the error rate distribution; only used with -error-mode=logistic")
+	flag.StringVar(&opts.webhookURL, "webhook", "", "POST the lines of each step to this URL instead of writing them to stdout")
+	flag.StringVar(&opts.webhookTemplate, "webhook-template", defaultWebhookTemplate, "Go template for the webhook request body; .Lines is the list of lines, .Batch is the batch number, and .Time is the send time")
+	flag.Var(&opts.webhookHeaders, "webhook-header", "header to add to webhook requests, as 'Name: value'; may be repeated")
+	flag.StringVar(&opts.remoteWriteURL, "remote-write", "", "send samples to this Prometheus remote-write URL instead of writing them to stdout; requires -content prometheus")
+	flag.Var(&opts.remoteWriteHeaders, "remote-write-header", "header to add to remote-write requests, as 'Name: value'; may be repeated")
+	flag.StringVar(&opts.otlpURL, "otlp", "", "send lines as log records to this OTLP/HTTP logs URL (e.g. 'http://localhost:4318/v1/logs') instead of writing them to stdout")
+	flag.Var(&opts.otlpHeaders, "otlp-header", "header to add to OTLP requests, as 'Name: value'; may be repeated")
+	flag.StringVar(&opts.otlpResource, "otlp-resource", "service.name=rndout", "comma-separated resource attributes for OTLP log records")
+	flag.StringVar(&opts.otlpScope, "otlp-scope", "rndout", "instrumentation scope name for OTLP log records")
+	flag.StringVar(&opts.otlpProtocol, "otlp-protocol", OTLPProtocolHTTP, "protocol for OTLP requests, one of 'http/protobuf' or 'grpc'; with grpc, -otlp and -otlp-traces are the collector's https URL (e.g. 'https://localhost:4317')")
+	flag.StringVar(&opts.otlpTraces, "otlp-traces", "", "send lines as spans to this OTLP/HTTP traces URL (e.g. 'http://localhost:4318/v1/traces') instead of writing them to stdout")
+	flag.IntVar(&opts.spanDepth, "span-depth", 3, "number of levels in each trace tree; only used with -otlp-traces")
+	flag.IntVar(&opts.spanFanout, "span-fanout", 2, "number of children of each span above the deepest level; only used with -otlp-traces")
+	flag.DurationVar(&opts.spanDuration, "span-duration", 100*time.Millisecond, "duration of the root span of each trace; only used with -otlp-traces")
+	flag.StringVar(&opts.redisAddr, "redis", "", "add lines to a Redis stream on the server at this host:port instead of writing them to stdout")
+	flag.StringVar(&opts.redisKey, "redis-key", "rndout", "key of the Redis stream")
+	flag.Int64Var(&opts.redisMaxLen, "redis-maxlen", 0, "trim the Redis stream to about this many entries; if 0, do not trim the stream")
+	flag.IntVar(&opts.redisPipeline, "redis-pipeline", 100, "maximum number of Redis commands to send before reading their replies")
+	flag.StringVar(&opts.udpAddr, "udp", "", "send lines as UDP datagrams to this host:port instead of writing them to stdout")
+	flag.IntVar(&opts.udpPacketSize, "udp-packet-size", 1432, "maximum size of a UDP datagram; datagrams contain as many whole lines as fit")
+	flag.StringVar(&opts.mqtt.Addr, "mqtt", "", "publish lines to the MQTT broker at this host:port instead of writing them to stdout")
+	flag.StringVar(&opts.mqtt.Topic, "mqtt-topic", "rndout", "topic for MQTT messages")
+	flag.IntVar(&opts.mqtt.QoS, "mqtt-qos", 0, "quality of service for MQTT messages, one of 0, 1, or 2")
+	flag.BoolVar(&opts.mqtt.Retain, "mqtt-retain", false, "set the retain flag on MQTT messages")
+	flag.BoolVar(&opts.mqtt.TLS, "mqtt-tls", false, "connect to the MQTT broker with TLS")
+	flag.StringVar(&opts.mqtt.ClientID, "mqtt-client-id", "", "client identifier for the MQTT connection; if empty, use 'rndout-' and the process ID")
+	flag.StringVar(&opts.mqtt.Username, "mqtt-username", "", "user name for the MQTT connection")
+	flag.StringVar(&opts.mqtt.Password, "mqtt-password", "", "password for the MQTT connection")
+	flag.BoolVar(&opts.tar, "tar", false, "write a tar archive of generated log files instead of plain lines; the run ends when the archive is complete")
+	flag.IntVar(&opts.tarFiles, "tar-files", 100, "number of files in the tar archive; only used with -tar")
+	flag.StringVar(&opts.tarFileSize, "tar-file-size", "64k", "mean size of each file in the tar archive; only used with -tar")
+	flag.StringVar(&opts.tarSizeDist, "tar-size-dist", SizeDistExponential, "distribution of file sizes in the tar archive, one of 'fixed', 'uniform', or 'exponential'; only used with -tar")
+	flag.BoolVar(&opts.crlf, "crlf", runtime.GOOS == "windows", "end lines with CRLF instead of LF")
+	flag.StringVar(&opts.prefix, "prefix", "", "text to add to the start of each line, after any sequence number and timestamp; {pid}, {host}, and {writer} are replaced with the process ID, host name, and writer number")
+	flag.StringVar(&opts.suffix, "suffix", "", "text to add to the end of each line, before the line ending; supports the same substitutions as -prefix")
+	flag.StringVar(&opts.header, "header", "", "Go template for text to write before any other output, like a CSV header; .Time is the start time")
+	flag.StringVar(&opts.footer, "footer", "", "Go template for text to write when the run ends; .Time, .Elapsed, .Rate, and the stats fields (e.g. .Bytes) describe the run")
+	flag.BoolVar(&opts.checksumTrailer, "checksum-trailer", false, "when the run ends, write a trailer line with the SHA-256 hash and size of all output before it")
+	flag.StringVar(&opts.checksumFile, "checksum-file", "", "when the run ends, write the SHA-256 hash of all output to this file, in the format of sha256sum for stdin")
+	flag.StringVar(&opts.timestamp, "timestamp", "", "start each line with a timestamp in this format: 'rfc3339', 'rfc3339nano', 'unix', 'unixms', or a Go time layout")
+	flag.Float64Var(&opts.clockDrift, "clock-drift", 0, "rate at which timestamps drift from the system clock, in seconds per second (e.g. 0.001 gains 1ms each second)")
+	flag.DurationVar(&opts.clockStepInterval, "clock-step-interval", 0, "mean time between random jumps in timestamps; if 0, timestamps do not jump")
+	flag.DurationVar(&opts.clockStepSize, "clock-step-size", time.Second, "maximum size of a jump in timestamps, forward or backward")
+	flag.BoolVar(&opts.sequence, "sequence", false, "start each line with a sequence number; use 'rndout check' to verify delivery")
 
-	// logistic flags
-	flag.IntVar(&opts.scale, "scale", 25, "scale factor for the output distribution; only used with -mode=logistic")
+	flag.StringVar(&opts.onError, "on-error", OnErrorContinue, "what to do when a write fails, one of 'continue', 'abort', or 'pause'")
+	flag.StringVar(&opts.blocked, "blocked", BlockedStretch, "what to do with steps missed while a write blocks, one of 'stretch', 'drop', or 'catch-up'")
+	flag.StringVar(&opts.maxBurst, "max-burst", "0", "maximum bytes to write in one step or one write; if 0, there is no limit")
+	flag.StringVar(&opts.burstExcess, "burst-excess", ExcessDefer, "what to do with bytes over -max-burst in a step, one of 'defer' to later steps or 'drop'")
+	flag.StringVar(&opts.tokenBucket, "token-bucket", "0", "pace output with a token bucket of this many bytes: each step, including missed steps, adds its planned bytes and writes consume them; if 0, write the planned bytes of each step")
+	flag.IntVar(&opts.retries, "retries", 0, "maximum number of times to retry a write that fails with a transient error")
+	flag.DurationVar(&opts.retryBackoff, "retry-backoff", 100*time.Millisecond, "time to wait before the first retry; doubles after each retry")
+	flag.DurationVar(&opts.retryMaxBackoff, "retry-max-backoff", 5*time.Second, "maximum time to wait between retries")
+	flag.StringVar(&opts.checkpoint, "checkpoint", "", "periodically save the state of the run to this file, so that an interrupted run can continue with -resume")
+	flag.DurationVar(&opts.checkpointInterval, "checkpoint-interval", time.Minute, "interval between checkpoints; only used with -checkpoint")
+	flag.StringVar(&opts.watch, "watch", "", "read rate, shape, and -events flags from this file, one per line like 'rate=10k', and apply changes to the file while running from the next step")
+	flag.BoolVar(&opts.resume, "resume", false, "continue the run saved in the -checkpoint file; all other flags must be the same as for the saved run")
+
+	// stats flags
+	flag.StringVar(&opts.statsdAddr, "statsd", "", "send run metrics to the statsd server at this host:port")
+	flag.StringVar(&opts.statsdPrefix, "statsd-prefix", "rndout", "prefix for statsd metric names")
+	flag.StringVar(&opts.statsdTags, "statsd-tags", "", "comma-separated DogStatsD tags (e.g. 'env:ci,job:build') added to statsd metrics")
+	flag.DurationVar(&opts.statsdInterval, "statsd-interval", 10*time.Second, "interval between statsd metric updates")
+	flag.IntVar(&opts.statsFD, "stats-fd", 0, "write newline-delimited JSON stats records to this file descriptor")
+	flag.StringVar(&opts.statsFile, "stats-file", "", "write newline-delimited JSON stats records to this file")
+	flag.DurationVar(&opts.statsInterval, "stats-interval", 0, "interval between stats records; if 0, write a record after every step")
+	flag.BoolVar(&opts.tui, "tui", false, "show a live view of the run on stderr; stdout must not be a terminal")
+	flag.BoolVar(&opts.progress, "progress", true, "show a progress line on stderr if it is a terminal and stdout is not")
+	flag.StringVar(&opts.traceFile, "trace-file", "", "write a CSV trace of the planned and written bytes for each step to this file")
+}
 
-	// ramp flags
-	flag.DurationVar(&opts.rampDuration, "ramp-duration", 10*time.Second, "time taken to reach the peak rate; only used with -mode=ramp")
+// commands are subcommands selected by the first argument. Each command
+// parses its own flags from the remaining arguments.
+var commands = map[string]func(args []string){
+	"check":    checkMain,
+	"diff":     diffMain,
+	"parquet":  parquetMain,
+	"plan":     planMain,
+	"record":   recordMain,
+	"rotate":   rotateMain,
+	"throttle": throttleMain,
+	"verify":   verifyMain,
+	"wrap":     wrapMain,
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			cmd(os.Args[2:])
+			return
+		}
+	}
+
 	flag.Parse()
+	os.Exit(run())
+}
 
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+// run generates output and returns the exit code. Setup errors exit directly
+// with die.
+func run() (code int) {
+	// all random decisions use r so that output is reproducible for a seed;
+	// keep the order of calls in sync with the README when changing them
+	seed := opts.seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	var ckpt *Checkpoint
+	if opts.resume {
+		if opts.checkpoint == "" {
+			die("invalid -resume: requires -checkpoint")
+		}
+		var err error
+		if ckpt, err = ReadCheckpoint(opts.checkpoint); err != nil {
+			die(err)
+		}
+		if !ckpt.Matches(flag.CommandLine) {
+			die("invalid -resume: flags are not the same as for the saved run")
+		}
+		if ckpt.Complete {
+			die("invalid -resume: the saved run is complete")
+		}
+		seed = ckpt.Seed
+	}
+	src := newCountingSource(seed)
+	r := rand.New(src)
 
-	rate, err := parseRate(opts.peakRate)
+	// settings in the -watch file override the flags, which are the base
+	// for later changes to the file
+	var watchBase WatchConfig
+	if opts.watch != "" {
+		watchBase = WatchConfig{Shape: opts.shapeOptions, Events: opts.events}
+		c, err := ReadWatchConfig(opts.watch, watchBase)
+		if err != nil {
+			die(fmt.Errorf("invalid watch file %s: %w", opts.watch, err))
+		}
+		opts.shapeOptions, opts.events = c.Shape, c.Events
+	}
+
+	shaper, charsPerStep, err := opts.newShaper(r)
+	if err != nil {
+		die(err)
+	}
+	// shapes from changes to the -watch file draw from their own source, so
+	// that applying a change does not shift the rest of the output
+	var watchRand *rand.Rand
+	if opts.watch != "" {
+		watchRand = rand.New(rand.NewSource(r.Int63()))
+	}
+	if opts.jitter < 0 || opts.jitter >= opts.stepSize/2 {
+		die("invalid jitter: must be non-negative and less than half the step size")
+	}
+	if opts.clockStepInterval < 0 || opts.clockStepSize < 0 {
+		die("invalid clock step: interval and size must not be negative")
+	}
+	if opts.writers < 1 {
+		die("invalid writers: must be at least 1")
+	}
+	incidentRate, err := parseScaled("incident rate", opts.incidentRate)
+	if err != nil {
+		die(err)
+	}
+	if opts.incident < 0 || opts.incidentLag < 0 || incidentRate < 0 {
+		die("invalid incident: time, lag, and rate must not be negative")
+	}
+	if opts.incidentScale < 1 {
+		die("invalid incident scale: must be at least 1")
+	}
+	// during an incident, each writer bursts incidentLag after the previous
+	var incident []RateShaper
+	if opts.incident > 0 {
+		for i := 0; i < opts.writers; i++ {
+			peak := opts.incident + time.Duration(i)*opts.incidentLag
+			incident = append(incident, LogisticShaper{Mu: int(peak / opts.stepSize), Scale: opts.incidentScale})
+		}
+	}
+	incidentPerStep := float64(incidentRate) * opts.stepSize.Seconds()
+	if opts.tar && opts.writers > 1 {
+		die("invalid -tar: concurrent writers are not supported")
+	}
+	if opts.checkpoint != "" && (opts.tar || opts.writers > 1) {
+		die("invalid -checkpoint: -tar and concurrent writers are not supported")
+	}
+	if opts.checkpointInterval <= 0 {
+		die("invalid checkpoint interval: must be greater than zero")
+	}
+	if strings.ContainsAny(opts.prefix+opts.suffix, "\r\n") {
+		die("invalid prefix or suffix: must not contain line breaks")
+	}
+	tagged := opts.prefix != "" || opts.suffix != ""
+	var header, footer *template.Template
+	if opts.header != "" {
+		if header, err = ParseFrame("header", opts.header); err != nil {
+			die(err)
+		}
+	}
+	if opts.footer != "" {
+		if footer, err = ParseFrame("footer", opts.footer); err != nil {
+			die(err)
+		}
+	}
+	if opts.tar && (header != nil || footer != nil || opts.checksumTrailer) {
+		die("invalid -tar: -header, -footer, and -checksum-trailer are not supported")
+	}
+	if opts.content == ContentJournal && (opts.sequence || opts.timestamp != "" || tagged) {
+		die("invalid content: journal entries can't have -sequence, -timestamp, -prefix, or -suffix")
+	}
+	text := NewTextFunc(opts.text)
+	if text == nil {
+		die("invalid text: must be one of 'uniform' or 'english'")
+	}
+	binary := opts.binary()
+	if binary && (opts.sequence || opts.timestamp != "" || tagged) {
+		die("invalid content: binary records can't have -sequence, -timestamp, -prefix, or -suffix")
+	}
+	errorRate, err := parseScaled("error rate", opts.errorRate)
 	if err != nil {
 		die(err)
 	}
-	if opts.stepSize > opts.duration {
-		die("invalid step size: must be less than duration")
+	var errorShaper RateShaper
+	if errorRate > 0 {
+		if opts.content != ContentJSON && opts.content != ContentJournal {
+			die("invalid -error-rate: requires -content json or journal")
+		}
+		if opts.errorPeak == 0 {
+			opts.errorPeak = opts.duration / 2
+		}
+		switch opts.errorMode {
+		case LogisticMode:
+			if opts.errorScale < 1 {
+				die("invalid error scale: must be at least 1")
+			}
+			errorShaper = LogisticShaper{Mu: int(opts.errorPeak / opts.stepSize), Scale: opts.errorScale}
+		case RampMode:
+			errorShaper = RampShaper{PeakStep: int(opts.errorPeak / opts.stepSize)}
+		default:
+			die("invalid error mode: must be one of 'logistic' or 'ramp'")
+		}
+	} else if errorRate < 0 {
+		die("invalid error rate: must not be negative")
+	}
+	errorsPerStep := float64(errorRate) * opts.stepSize.Seconds()
+	events, err := ParseEventMix(opts.events)
+	if err != nil {
+		die(err)
+	}
+	sinks := 0
+	for _, url := range []string{opts.webhookURL, opts.remoteWriteURL, opts.otlpURL, opts.otlpTraces, opts.redisAddr, opts.mqtt.Addr, opts.udpAddr} {
+		if url != "" {
+			sinks++
+		}
+	}
+	if sinks > 1 {
+		die("invalid sinks: only one sink may be used")
+	}
+	if sinks > 0 && (opts.tar || opts.writers > 1) {
+		die("invalid sink: -tar and concurrent writers are not supported")
+	}
+	if binary && (sinks > 0 || opts.writers > 1) {
+		die("invalid content: binary records can't be used with sinks or concurrent writers")
+	}
+	if opts.redisMaxLen < 0 {
+		die("invalid redis maxlen: must not be negative")
+	}
+	if opts.redisPipeline < 1 {
+		die("invalid redis pipeline: must be at least 1")
+	}
+	if opts.udpPacketSize < 1 {
+		die("invalid UDP packet size: must be at least 1")
+	}
+	if opts.mqtt.QoS < 0 || opts.mqtt.QoS > 2 {
+		die("invalid MQTT QoS: must be one of 0, 1, or 2")
+	}
+	if opts.mqtt.Topic == "" || strings.ContainsAny(opts.mqtt.Topic, "+#") {
+		die("invalid MQTT topic: must be non-empty and must not contain the wildcards '+' or '#'")
+	}
+	if opts.mqtt.Password != "" && opts.mqtt.Username == "" {
+		die("invalid MQTT password: requires -mqtt-username")
+	}
+	if opts.spanDepth < 1 || opts.spanFanout < 1 {
+		die("invalid span tree: depth and fanout must be at least 1")
+	}
+	if opts.spanDuration <= 0 {
+		die("invalid span duration: must be greater than zero")
+	}
+	switch opts.otlpProtocol {
+	case OTLPProtocolHTTP:
+	case OTLPProtocolGRPC:
+		for _, u := range []string{opts.otlpURL, opts.otlpTraces} {
+			if u != "" && !strings.HasPrefix(u, "https://") {
+				die("invalid OTLP URL: gRPC requires an https URL, as the HTTP/2 client only connects over TLS")
+			}
+		}
+	default:
+		die("invalid OTLP protocol: must be one of 'http/protobuf' or 'grpc'")
+	}
+	if opts.remoteWriteURL != "" && (opts.content != ContentPrometheus || opts.sequence || opts.timestamp != "" || tagged) {
+		die("invalid -remote-write: requires -content prometheus without -sequence, -timestamp, -prefix, or -suffix")
+	}
+	tarFileSize, err := parseScaled("tar file size", opts.tarFileSize)
+	if err != nil {
+		die(err)
+	}
+	if opts.tarFiles < 0 || tarFileSize < 0 {
+		die("invalid tar files: count and size must not be negative")
+	}
+	switch opts.tarSizeDist {
+	case SizeDistFixed, SizeDistUniform, SizeDistExponential:
+	default:
+		die("invalid tar size distribution: must be one of 'fixed', 'uniform', or 'exponential'")
+	}
+	if opts.writeSize < 1 {
+		die("invalid write size: must be at least 1")
+	}
+	switch opts.rateUnit {
+	case RateUnitBytes:
+	case RateUnitRunes:
+		if opts.tar || binary {
+			die("invalid rate unit: runes can't be used with -tar or binary records")
+		}
+	case RateUnitSpans:
+		if opts.otlpTraces == "" {
+			die("invalid rate unit: spans can only be used with -otlp-traces")
+		}
+	default:
+		die("invalid rate unit: must be one of 'bytes', 'runes', or 'spans'")
+	}
+	if opts.drip < 0 {
+		die("invalid drip: must not be negative")
+	}
+	if opts.drip > 0 && sinks > 0 {
+		die("invalid -drip: sinks are not supported")
+	}
+	if (opts.checksumTrailer || opts.checksumFile != "") && sinks > 0 {
+		die("invalid checksum: sinks are not supported")
+	}
+	if (opts.checksumTrailer || opts.checksumFile != "") && opts.writers > 1 {
+		// concurrent writes reach stdout in an order the hash can't see
+		// without serializing the writers
+		die("invalid checksum: concurrent writers are not supported")
+	}
+	switch opts.dripDist {
+	case SizeDistFixed, SizeDistUniform, SizeDistExponential:
+	default:
+		die("invalid drip distribution: must be one of 'fixed', 'uniform', or 'exponential'")
+	}
+	if opts.dripFragment < 1 {
+		die("invalid drip fragment: must be at least 1")
 	}
 	if opts.skips > opts.sliceLen {
 		die("invalid skips: must be less than slice length")
@@ -75,43 +573,746 @@ func main() {
 	if opts.skipProb > 1 || opts.skipProb < 0 {
 		die("invalid skip probability: must be in [0.0, 1.0]")
 	}
+	switch opts.onError {
+	case OnErrorContinue, OnErrorAbort, OnErrorPause:
+	default:
+		die("invalid on-error: must be one of 'continue', 'abort', or 'pause'")
+	}
+	switch opts.blocked {
+	case BlockedStretch, BlockedDrop, BlockedCatchUp:
+	default:
+		die("invalid blocked: must be one of 'stretch', 'drop', or 'catch-up'")
+	}
+	tokenBucket, err := parseScaled("token bucket", opts.tokenBucket)
+	if err != nil {
+		die(err)
+	}
+	if tokenBucket < 0 {
+		die("invalid token bucket: must not be negative")
+	}
+	if tokenBucket > 0 && opts.blocked != BlockedStretch {
+		die("invalid token bucket: can't be combined with -blocked drop or catch-up")
+	}
+	maxBurst, err := parseScaled("max burst", opts.maxBurst)
+	if err != nil {
+		die(err)
+	}
+	if maxBurst < 0 {
+		die("invalid max burst: must not be negative")
+	}
+	switch opts.burstExcess {
+	case ExcessDefer, ExcessDrop:
+	default:
+		die("invalid burst excess: must be one of 'defer' or 'drop'")
+	}
+	if opts.retries < 0 {
+		die("invalid retries: must not be negative")
+	}
+	if opts.retryBackoff < 0 || opts.retryMaxBackoff < opts.retryBackoff {
+		die("invalid retry backoff: must not be negative or greater than the maximum backoff")
+	}
+	if opts.statsdInterval <= 0 {
+		die("invalid statsd interval: must be greater than zero")
+	}
+	if opts.statsFD < 0 || opts.statsFD == 1 || opts.statsFD == 2 {
+		die("invalid stats file descriptor: must not be stdout or stderr")
+	}
+	if opts.statsFD > 0 && opts.statsFile != "" {
+		die("invalid stats output: only one of -stats-fd and -stats-file may be set")
+	}
+	if opts.statsInterval < 0 {
+		die("invalid stats interval: must not be negative")
+	}
+	if opts.tui && (isTerminal(os.Stdout) || !isTerminal(os.Stderr)) {
+		die("invalid -tui: stderr must be a terminal and stdout must not be a terminal")
+	}
+	if opts.tui && !enableEscapes(os.Stderr) {
+		die("invalid -tui: the terminal does not support escape sequences")
+	}
 
-	charsPerStep := float64(rate) * opts.stepSize.Seconds()
+	eol := opts.lineEnding(opts.crlf)
+	if opts.blockSize < len(eol)+1 {
+		die(fmt.Sprintf("invalid block size: must be at least %d", len(eol)+1))
+	}
+
+	// source generates lines for content other than random
+	source, err := opts.newSource(eol, opts.blockSize, text, events, time.Now)
+	if err != nil {
+		die(err)
+	}
 
-	var shaper RateShaper
-	switch opts.mode {
-	case LogisticMode:
-		peakStep := r.Intn(int(opts.duration / opts.stepSize))
-		shaper = LogisticShaper{Mu: peakStep, Scale: opts.scale}
+	if opts.plan {
+		p := Planner{
+			Steps:        int(opts.duration / opts.stepSize),
+			StepSize:     opts.stepSize,
+			Shapers:      []RateShaper{shaper},
+			CharsPerStep: charsPerStep,
+			SliceLen:     opts.sliceLen,
+			Skips:        opts.skips,
+			SkipProb:     opts.skipProb,
+			MaxBurst:     int(maxBurst),
+			DropExcess:   opts.burstExcess == ExcessDrop,
+			LineSize:     float64(opts.blockSize),
+			Writers:      opts.writers,
+		}
+		if opts.seed == 0 && opts.mode == LogisticMode {
+			p.Shapers = LogisticPeaks(p.Steps, opts.scale, maxPlanPeaks)
+		}
+		if errorShaper != nil || len(incident) > 0 {
+			p.Extra = func(step int) float64 {
+				var n float64
+				if errorShaper != nil {
+					n += errorsPerStep * errorShaper.Fraction(step)
+				}
+				for _, s := range incident {
+					n += float64(int(incidentPerStep * s.Fraction(step)))
+				}
+				return n
+			}
+		}
+		if source != nil {
+			p.LineSize = MeanLineSize(source, eol) + float64(len(opts.prefix)+len(opts.suffix))
+			p.WholeLines = true
+		}
+		p.Plan().Report(os.Stdout)
+		return 0
+	}
 
-	case RampMode:
-		peakStep := int(opts.rampDuration / opts.stepSize)
-		shaper = RampShaper{PeakStep: peakStep}
+	var stats Stats
+	if ckpt != nil {
+		stats = ckpt.Stats
+	}
 
-	default:
-		die("invalid mode: must be one of 'logistic' or 'ramp'")
+	// open stats outputs first so they close after reporters finish
+	var statsOut *os.File
+	switch {
+	case opts.statsFD > 0:
+		statsOut = os.NewFile(uintptr(opts.statsFD), "stats")
+	case opts.statsFile != "":
+		if statsOut, err = os.Create(opts.statsFile); err != nil {
+			die(err)
+		}
+	}
+	if statsOut != nil {
+		defer statsOut.Close()
 	}
 
-	out := NewRandomOutput(r, 32, opts.blockSize)
+	var trace *Trace
+	if opts.traceFile != "" {
+		f, err := os.Create(opts.traceFile)
+		if err != nil {
+			die(err)
+		}
+		trace = NewTrace(f)
+		defer func() {
+			// a run that otherwise succeeded fails if its trace is incomplete
+			if err := trace.Close(); err != nil {
+				fmt.Fprintf(os.Stderr, "write failed for trace file: %v\n", err)
+				if code == 0 {
+					code = exitWriteErrors
+				}
+			}
+		}()
+	}
 
-	end := time.After(opts.duration)
-	steps := time.Tick(opts.stepSize)
+	// stop signals reporters to finish and waits for them
+	var wg sync.WaitGroup
+	var stopOnce sync.Once
+	done := make(chan struct{})
+	stop := func() {
+		stopOnce.Do(func() {
+			close(done)
+			wg.Wait()
+		})
+	}
+	defer stop()
 
-	var skips int
-	for step := 0; true; step++ {
-		sliceIdx := step % opts.sliceLen
-		if sliceIdx == 0 {
+	if opts.statsdAddr != "" {
+		e, err := NewStatsdEmitter(opts.statsdAddr, opts.statsdPrefix, splitList(opts.statsdTags), &stats)
+		if err != nil {
+			die(err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.Run(opts.statsdInterval, done)
+		}()
+	}
+
+	var stream *StatsStream
+	if statsOut != nil {
+		stream = NewStatsStream(statsOut, &stats, time.Now())
+		if opts.statsInterval > 0 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				stream.Run(opts.statsInterval, done)
+			}()
+		}
+	}
+
+	if opts.tui {
+		interval := opts.stepSize
+		if interval < minTUIInterval {
+			interval = minTUIInterval
+		}
+
+		t := NewTUI(os.Stderr, &stats, time.Now(), opts.duration)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t.Run(interval, done)
+		}()
+	}
+
+	if opts.progress && !opts.tui && isTerminal(os.Stderr) && !isTerminal(os.Stdout) && enableEscapes(os.Stderr) {
+		p := NewProgress(os.Stderr, &stats, time.Now(), opts.duration)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.Run(progressInterval, done)
+		}()
+	}
+
+	var configs chan WatchConfig
+	if opts.watch != "" {
+		configs = make(chan WatchConfig, 1)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			WatchConfigFile(opts.watch, watchBase, watchInterval, configs, done)
+		}()
+	}
+
+	out := NewRandomOutput(r, 32, opts.blockSize, eol, text)
+	var seq Sequence
+	if opts.sequence {
+		out.Decorators = append(out.Decorators, seq.Decorator())
+	}
+	if opts.timestamp != "" {
+		clock := NewDriftClock(rand.New(rand.NewSource(r.Int63())), time.Now(), opts.clockDrift, opts.clockStepInterval, opts.clockStepSize)
+		out.Decorators = append(out.Decorators, TimestampDecorator(clock.Now, opts.timestamp))
+	}
+	// tags are added to each writer's output, since they may include the
+	// writer number
+	tag := func(out *RandomOutput, writer int) {
+		if tagged {
+			out.Decorators = append(out.Decorators, TagDecorator(ExpandTag(opts.prefix, writer), ExpandTag(opts.suffix, writer)))
+		}
+	}
+	if opts.writers == 1 {
+		tag(out, 0)
+	}
+	// sink replaces stdout as the destination for output
+	var sink io.Writer
+	switch {
+	case opts.webhookURL != "":
+		if sink, err = NewWebhookSink(opts.webhookURL, opts.webhookTemplate, opts.webhookHeaders, eol); err != nil {
+			die(err)
+		}
+	case opts.remoteWriteURL != "":
+		if sink, err = NewRemoteWriteSink(opts.remoteWriteURL, opts.remoteWriteHeaders, eol); err != nil {
+			die(err)
+		}
+	case opts.otlpURL != "":
+		s, err := NewOTLPSink(opts.otlpURL, opts.otlpHeaders, splitList(opts.otlpResource), opts.otlpScope, eol)
+		if err != nil {
+			die(err)
+		}
+		s.GRPC = opts.otlpProtocol == OTLPProtocolGRPC
+		sink = s
+	case opts.otlpTraces != "":
+		s, err := NewOTLPSink(opts.otlpTraces, opts.otlpHeaders, splitList(opts.otlpResource), opts.otlpScope, eol)
+		if err != nil {
+			die(err)
+		}
+		s.Spans = NewSpanTree(opts.spanDepth, opts.spanFanout, opts.spanDuration)
+		s.GRPC = opts.otlpProtocol == OTLPProtocolGRPC
+		sink = s
+	case opts.redisAddr != "":
+		sink = NewRedisSink(opts.redisAddr, opts.redisKey, opts.redisMaxLen, opts.redisPipeline, eol)
+	case opts.udpAddr != "":
+		if sink, err = NewUDPSink(opts.udpAddr, opts.udpPacketSize, eol); err != nil {
+			die(err)
+		}
+	case opts.mqtt.Addr != "":
+		if opts.mqtt.ClientID == "" {
+			opts.mqtt.ClientID = fmt.Sprintf("rndout-%d", os.Getpid())
+		}
+		sink = NewMQTTSink(opts.mqtt, eol)
+	}
+
+	out.Source = source
+	out.MaxBurst = int(maxBurst)
+	out.Runes = opts.rateUnit == RateUnitRunes
+	out.Lines = opts.rateUnit == RateUnitSpans
+	var overlay *ErrorOverlay
+	if errorShaper != nil {
+		overlay = &ErrorOverlay{Source: out.Source.(ErrorLineSource)}
+		out.Source = overlay
+	}
+
+	// each drip writer has its own random source, seeded from drips
+	var drips *rand.Rand
+	if opts.drip > 0 {
+		drips = rand.New(rand.NewSource(r.Int63()))
+	}
+
+	// sum hashes all output for -checksum-trailer and -checksum-file
+	var sum *StreamHash
+	if opts.checksumTrailer || opts.checksumFile != "" {
+		sum = NewStreamHash()
+	}
+
+	newWriter := func(dst io.Writer) io.Writer {
+		if sum != nil {
+			dst = sum.Writer(dst)
+		}
+		if maxBurst > 0 && dst != sink {
+			// sinks get a step's lines in one batch, so only the step is
+			// limited
+			dst = ChunkWriter{W: dst, Size: int(maxBurst)}
+		}
+		if drips != nil {
+			dst = NewDripWriter(dst, rand.New(rand.NewSource(drips.Int63())), opts.dripFragment, opts.drip, opts.dripDist)
+		}
+		return StatsWriter{
+			W: RetryWriter{
+				W:          dst,
+				Stats:      &stats,
+				Retries:    opts.retries,
+				Backoff:    opts.retryBackoff,
+				MaxBackoff: opts.retryMaxBackoff,
+			},
+			Stats: &stats,
+		}
+	}
+
+	// bursts are the bytes each writer adds in the current step because of
+	// an incident, set when the step is planned
+	bursts := make([]int, len(incident))
+
+	// write writes about n characters of output and frame writes the header
+	// and footer
+	var write func(n int) (int, error)
+	var frame io.Writer
+	if opts.writers > 1 {
+		frame = newWriter(newOutputWriter(os.Stdout))
+		outs := make([]*RandomOutput, opts.writers)
+		ws := make([]io.Writer, opts.writers)
+		files := make([]*os.File, 0, opts.writers)
+		for i := range outs {
+			outs[i] = out.Clone(rand.New(rand.NewSource(r.Int63())))
+			if maxBurst > 0 {
+				// writers share the limit for each step
+				if outs[i].MaxBurst = int(maxBurst) / opts.writers; outs[i].MaxBurst < 1 {
+					outs[i].MaxBurst = 1
+				}
+			}
+			tag(outs[i], i)
+			if opts.content == ContentRandom {
+				outs[i].Decorators = append(outs[i].Decorators, WriterDecorator(i))
+			}
+
+			f, err := dupFile(os.Stdout)
+			if err != nil {
+				die(err)
+			}
+			files = append(files, f)
+			ws[i] = newWriter(newOutputWriter(f))
+		}
+
+		// the duplicated descriptors are closed after the writers stop;
+		// platforms that can't duplicate them return stdout itself
+		defer func() {
+			for _, f := range files {
+				if f != os.Stdout {
+					f.Close()
+				}
+			}
+		}()
+
+		co := NewConcurrentOutput(outs, ws, opts.writeSize)
+		defer co.Close()
+		write = func(n int) (int, error) {
+			return co.WriteShares(n, bursts)
+		}
+	} else if opts.tar {
+		tr := rand.New(rand.NewSource(r.Int63()))
+		archive := NewTarArchive(out.Clone(tr), tr, opts.tarFiles, tarFileSize, opts.tarSizeDist)
+		defer archive.Close()
+
+		w := newWriter(newOutputWriter(os.Stdout))
+		write = func(n int) (int, error) {
+			return archive.WriteN(w, n)
+		}
+	} else if sink != nil {
+		// sinks receive each step's lines in a single write
+		w := newWriter(sink)
+		frame = w
+		var batch bytes.Buffer
+		write = func(n int) (int, error) {
+			batch.Reset()
+			if _, err := out.WriteN(&batch, n); err != nil || batch.Len() == 0 {
+				return 0, err
+			}
+			nw, err := w.Write(batch.Bytes())
+			switch {
+			case out.Runes:
+				nw = utf8.RuneCount(batch.Bytes()[:nw])
+			case out.Lines:
+				nw = bytes.Count(batch.Bytes()[:nw], []byte(eol))
+			}
+			return nw, err
+		}
+	} else {
+		w := newWriter(newOutputWriter(os.Stdout))
+		frame = w
+		write = func(n int) (int, error) {
+			return out.WriteN(w, n)
+		}
+	}
+
+	// a resumed run continues from the step after the saved one, as if it
+	// had started that many steps ago
+	start := time.Now()
+	if ckpt != nil {
+		start = start.Add(-time.Duration(ckpt.Due+1) * opts.stepSize)
+	}
+	if header != nil && ckpt == nil {
+		b, err := RenderFrame(header, StatsRecord{Time: start}, eol)
+		if err != nil {
+			die(fmt.Errorf("invalid header: %w", err))
+		}
+		if _, err := frame.Write(b); err != nil {
+			fmt.Fprintf(os.Stderr, "write failed for header: %v\n", err)
+		}
+	}
+	if sum != nil {
+		// deferred before the footer so that the checksum includes it
+		defer func() {
+			hash, n := sum.Sum()
+			if opts.checksumFile != "" {
+				if err := os.WriteFile(opts.checksumFile, []byte(hash+"  -\n"), 0o644); err != nil {
+					fmt.Fprintf(os.Stderr, "write failed for checksum file: %v\n", err)
+				}
+			}
+			if opts.checksumTrailer {
+				if _, err := fmt.Fprintf(frame, "rndout-trailer sha256=%s bytes=%d%s", hash, n, eol); err != nil {
+					fmt.Fprintf(os.Stderr, "write failed for checksum trailer: %v\n", err)
+				}
+			}
+		}()
+	}
+	if footer != nil {
+		// the footer is written after every kind of ending, but a failure
+		// to write it does not change the exit status
+		defer func() {
+			elapsed := time.Since(start)
+			st := stats.Snapshot()
+			rec := StatsRecord{Time: time.Now(), Elapsed: elapsed.Seconds(), Stats: st, Rate: float64(st.Bytes) / elapsed.Seconds()}
+			b, err := RenderFrame(footer, rec, eol)
+			if err == nil {
+				_, err = frame.Write(b)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "write failed for footer: %v\n", err)
+			}
+		}()
+	}
+
+	step, lastDue := -1, -1
+	if ckpt != nil {
+		step, lastDue = ckpt.Step, ckpt.Due
+	}
+	end := time.After(opts.duration - time.Since(start))
+	clock := NewStepClock(start, opts.stepSize, opts.jitter, r, lastDue+1)
+	defer clock.Stop()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	terminate := make(chan os.Signal, 1)
+	signal.Notify(terminate, syscall.SIGTERM)
+	defer signal.Stop(terminate)
+
+	// receiving SIGPIPE makes writes to a closed stdout return EPIPE instead
+	// of terminating the process, so the run can end with a summary
+	signal.Notify(make(chan os.Signal, 1), syscall.SIGPIPE)
+
+	record := func(st StepTrace) {
+		if stream != nil && opts.statsInterval == 0 {
+			stream.Record()
+		}
+		if trace != nil {
+			trace.Record(st)
+		}
+	}
+
+	// state for -on-error
+	exitCode := 0
+	var paused bool
+	var pausedAt, nextProbe time.Time
+	var pending int
+	var backoff time.Duration
+
+	// plan returns the number of bytes to write in a step and false if the
+	// step is skipped. Steps must be planned in increasing order.
+	slice, skips := -1, 0
+	var spanCarry float64
+	plan := func(step int) (int, bool) {
+		if s := step / opts.sliceLen; s != slice {
+			slice = s
 			skips = sampleSkips(r, opts.skips, opts.skipProb)
 		}
+		skipped := step%opts.sliceLen >= opts.sliceLen-skips
+		for i, s := range incident {
+			if bursts[i] = 0; !skipped {
+				bursts[i] = int(incidentPerStep * s.Fraction(step))
+			}
+		}
+		if skipped {
+			return 0, false
+		}
+		n := charsPerStep * shaper.Fraction(step)
+		if overlay != nil {
+			// errors are mixed into the step's lines in proportion to their
+			// share of its bytes
+			e := errorsPerStep * errorShaper.Fraction(step)
+			if n+e > 0 {
+				overlay.SetFraction(e / (n + e))
+			}
+			n += e
+		}
+		for _, b := range bursts {
+			n += float64(b)
+		}
+		if out.Lines {
+			// a step has few spans, so the fractions carry over to later
+			// steps instead of being lost
+			n += spanCarry
+			spanCarry = n - math.Floor(n)
+		}
+		return int(n), true
+	}
 
+	// tokens in the bucket with -token-bucket
+	var tokens float64
+
+	// bytes over -max-burst deferred to later steps
+	var deferred int
+
+	if ckpt != nil {
+		// the clock draws the jitter of its first tick, which the saved run
+		// already drew, before the source catches up
+		if src.n > ckpt.Draws {
+			die("invalid -resume: the checkpoint does not match the run")
+		}
+		src.Skip(ckpt.Draws)
+		slice, skips = ckpt.Slice, ckpt.Skips
+		tokens, deferred = ckpt.Tokens, ckpt.Deferred
+		out.pending = ckpt.Pending
+		seq.Next = ckpt.Sequence
+		exitCode = ckpt.ExitCode
+	}
+
+	// checkpoint saves the state of the run after the last step
+	var lastCheckpoint time.Time
+	checkpoint := func(complete bool) {
+		if opts.checkpoint == "" {
+			return
+		}
+		lastCheckpoint = time.Now()
+		c := Checkpoint{
+			Flags:    checkpointFlags(flag.CommandLine),
+			Seed:     seed,
+			Draws:    src.n,
+			Step:     step,
+			Due:      lastDue,
+			Slice:    slice,
+			Skips:    skips,
+			Tokens:   tokens,
+			Deferred: deferred,
+			Pending:  out.pending,
+			Sequence: atomic.LoadUint64(&seq.Next),
+			ExitCode: exitCode,
+			Complete: complete,
+			Stats:    stats.Snapshot(),
+		}
+		if err := c.Write(opts.checkpoint); err != nil {
+			fmt.Fprintf(os.Stderr, "checkpoint failed: %v\n", err)
+		}
+	}
+
+	// finish ends a run early, printing a summary after reporters stop
+	finish := func(reason string, code int) int {
+		checkpoint(false)
+		stop()
+		fmt.Fprintf(os.Stderr, "%s after %s: %s\n", reason, time.Since(start).Round(time.Millisecond), stats.Snapshot().Summary())
+		return code
+	}
+
+	for {
 		select {
-		case <-steps:
-			if sliceIdx < opts.sliceLen-skips {
-				n := int(charsPerStep * shaper.Fraction(step))
-				out.WriteN(os.Stdout, n)
+		case tick := <-clock.C:
+			step++
+
+			// detect ticks that were missed because a write blocked
+			due := clock.Tick(tick)
+			if missed := due - lastDue - 1; missed > 0 {
+				atomic.AddInt64(&stats.MissedSteps, int64(missed))
+			}
+			lastDue = due
+
+			var catchUp int
+			if opts.blocked != BlockedStretch || tokenBucket > 0 {
+				for ; step < due; step++ {
+					n, ok := plan(step)
+					if !ok {
+						continue
+					}
+					if tokenBucket > 0 {
+						tokens += float64(n)
+						continue
+					}
+					switch opts.blocked {
+					case BlockedDrop:
+						atomic.AddInt64(&stats.DroppedBytes, int64(n))
+					case BlockedCatchUp:
+						atomic.AddInt64(&stats.CatchUpBytes, int64(n))
+						catchUp += n
+					}
+				}
+			}
+
+			st := StepTrace{Step: step, Time: time.Now()}
+			atomic.AddInt64(&stats.Steps, 1)
+			n, ok := plan(step)
+			if tokenBucket > 0 && !paused {
+				if ok {
+					tokens += float64(n)
+				}
+				if excess := tokens - float64(tokenBucket); excess > 0 {
+					atomic.AddInt64(&stats.DroppedBytes, int64(excess))
+					tokens = float64(tokenBucket)
+				}
+				// lines are written whole, so writes can overdraw the
+				// bucket; the debt is paid by later steps
+				n, ok = int(tokens), tokens >= 1
+			}
+
+			switch {
+			case paused:
+				st.Skipped = true
+				atomic.AddInt64(&stats.PausedSteps, 1)
+				if st.Time.Before(nextProbe) {
+					break
+				}
+				if _, err = write(pending); err == nil {
+					fmt.Fprintf(os.Stderr, "output recovered after %s, resuming\n", st.Time.Sub(pausedAt).Round(time.Millisecond))
+					paused = false
+					break
+				}
+				if isClosedPipe(err) {
+					record(st)
+					return finish("output closed", exitClosedPipe)
+				}
+				nextProbe = st.Time.Add(backoff)
+				if backoff *= 2; backoff > opts.retryMaxBackoff {
+					backoff = opts.retryMaxBackoff
+				}
+
+			case ok || catchUp > 0:
+				st.Planned = n + catchUp
+				if maxBurst > 0 {
+					// with a token bucket, the deferred bytes stay in the
+					// bucket
+					if tokenBucket == 0 {
+						st.Planned += deferred
+						deferred = 0
+					}
+					if excess := st.Planned - int(maxBurst); excess > 0 {
+						st.Planned = int(maxBurst)
+						switch {
+						case opts.burstExcess == ExcessDrop:
+							atomic.AddInt64(&stats.DroppedBytes, int64(excess))
+							tokens -= float64(excess)
+						case tokenBucket == 0:
+							deferred = excess
+						}
+					}
+				}
+				atomic.AddInt64(&stats.PlannedBytes, int64(st.Planned))
+				st.Written, err = write(st.Planned)
+				st.Latency = time.Since(st.Time)
+				if tokenBucket > 0 {
+					tokens -= float64(st.Written)
+				}
+				if err == nil {
+					break
+				}
+				if err == io.EOF {
+					// the tar archive is complete
+					record(st)
+					return exitCode
+				}
+				if isClosedPipe(err) {
+					record(st)
+					return finish("output closed", exitClosedPipe)
+				}
+
+				switch opts.onError {
+				case OnErrorAbort:
+					record(st)
+					return finish(fmt.Sprintf("write failed (%v)", err), exitAborted)
+				case OnErrorContinue:
+					fmt.Fprintf(os.Stderr, "write failed at step %d: %v\n", step, err)
+					exitCode = exitWriteErrors
+				case OnErrorPause:
+					fmt.Fprintf(os.Stderr, "write failed at step %d, pausing: %v\n", step, err)
+					exitCode = exitPaused
+					paused, pausedAt = true, st.Time
+					backoff = opts.retryBackoff
+					nextProbe = st.Time.Add(backoff)
+					if pending = st.Planned - st.Written; pending < 1 {
+						pending = 1
+					}
+				}
+
+			default:
+				st.Skipped = true
+				atomic.AddInt64(&stats.SkippedSteps, 1)
 			}
+			record(st)
+			if !paused && time.Since(lastCheckpoint) >= opts.checkpointInterval {
+				checkpoint(false)
+			}
+		case c := <-configs:
+			// the new shape continues from the current step, so a logistic
+			// shape keeps its peak step
+			s, n, err := c.Shape.newShaper(watchRand)
+			var mix *EventMix
+			if err == nil {
+				mix, err = ParseEventMix(c.Events)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "invalid watch file %s, keeping the current settings: %v\n", opts.watch, err)
+				break
+			}
+			if old, ok := shaper.(LogisticShaper); ok && c.Shape.mode == LogisticMode {
+				s = LogisticShaper{Mu: old.Mu, Scale: c.Shape.scale}
+			}
+			shaper, charsPerStep = s, n
+			events.Set(mix)
+			fmt.Fprintf(os.Stderr, "applied watch file %s at step %d\n", opts.watch, step+1)
 		case <-end:
-			return
+			checkpoint(true)
+			return exitCode
+		case <-interrupt:
+			return finish("interrupted", exitInterrupted)
+		case <-terminate:
+			return finish("terminated", 0)
 		}
 	}
 }
@@ -121,6 +1322,29 @@ func die(msg interface{}) {
 	os.Exit(1)
 }
 
+// listFlag is a flag that may be repeated to build a list of values.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *listFlag) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// splitList splits a comma-separated list, ignoring empty elements.
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
 func sampleSkips(r *rand.Rand, skips int, skipProb float64) int {
 	if skips <= 0 || r.Float64() >= skipProb {
 		return 0
@@ -169,42 +1393,189 @@ func (s RampShaper) Fraction(step int) float64 {
 	return 1.0
 }
 
+// ReplayShaper follows a recorded trace, given as the fraction of the peak
+// for each step. Steps after the end of the trace have no output.
+type ReplayShaper struct {
+	Fractions []float64
+}
+
+func (s ReplayShaper) Fraction(step int) float64 {
+	if step < len(s.Fractions) {
+		return s.Fractions[step]
+	}
+	return 0
+}
+
+// A LineDecorator adds text to the start or end of a line. It appends to the
+// prefix and suffix and returns the extended slices.
+type LineDecorator func(prefix, suffix []byte) ([]byte, []byte)
+
 type RandomOutput struct {
-	bufs [][]byte
-	r    *rand.Rand
+	// Decorators are applied in order to each line. When a line has
+	// decorations, it is written in full even if it exceeds the remaining
+	// number of characters requested by WriteN.
+	Decorators []LineDecorator
+
+	// Source, if not nil, generates the content of each line instead of the
+	// random buffers. Generated lines are always written in full.
+	Source LineSource
+
+	// MaxBurst, if not zero, limits the characters written by WriteN. A
+	// generated line that would exceed it is kept for the next call, unless
+	// it is the first line of the call.
+	MaxBurst int
+
+	// Runes, if true, makes WriteN and MaxBurst count UTF-8 encoded
+	// characters instead of bytes.
+	Runes bool
+
+	// Lines, if true, makes WriteN and MaxBurst count line endings instead
+	// of bytes.
+	Lines bool
+
+	bufs    [][]byte
+	eol     string
+	r       *rand.Rand
+	scratch []byte
+	pending []byte
 }
 
-func NewRandomOutput(r *rand.Rand, n, blockSize int) *RandomOutput {
+// NewRandomOutput creates n buffers of random text, each blockSize characters
+// long and ending with eol.
+func NewRandomOutput(r *rand.Rand, n, blockSize int, eol string, text TextFunc) *RandomOutput {
 	bufs := make([][]byte, n)
 	for i := range bufs {
 		bufs[i] = make([]byte, blockSize)
-		for j := range bufs[i] {
-			bufs[i][j] = byte(alphabet[r.Intn(len(alphabet))])
-		}
-		bufs[i][blockSize-1] = '\n'
+		text(bufs[i], r)
+		copy(bufs[i][blockSize-len(eol):], eol)
 	}
 
 	return &RandomOutput{
 		bufs: bufs,
+		eol:  eol,
 		r:    r,
 	}
 }
 
-func (ro *RandomOutput) WriteN(w io.Writer, n int) (err error) {
+// Clone returns an output that shares the buffers of ro but uses r to pick
+// buffers and applies its own copy of the decorators.
+func (ro *RandomOutput) Clone(r *rand.Rand) *RandomOutput {
+	return &RandomOutput{
+		Decorators: append([]LineDecorator(nil), ro.Decorators...),
+		Source:     ro.Source,
+		MaxBurst:   ro.MaxBurst,
+		Runes:      ro.Runes,
+		Lines:      ro.Lines,
+		bufs:       ro.bufs,
+		eol:        ro.eol,
+		r:          r,
+	}
+}
+
+// WriteN writes about n characters and returns the number of characters
+// written, where characters are bytes or, with Runes, encoded characters.
+func (ro *RandomOutput) WriteN(w io.Writer, n int) (written int, err error) {
 	for n > 0 {
-		buf := ro.pickBuffer()
-		var nr int
-		if len(buf) > n {
-			nr, err = w.Write(buf[len(buf)-n:])
+		var buf []byte
+		if ro.Source != nil {
+			if buf = ro.pending; buf == nil {
+				buf = ro.generate()
+			}
+			if ro.MaxBurst > 0 && written > 0 && written+ro.count(buf) > ro.MaxBurst {
+				ro.pending = append(ro.pending[:0], buf...)
+				return written, nil
+			}
+			ro.pending = nil
 		} else {
-			nr, err = w.Write(buf)
+			buf = ro.pickBuffer()
+			if ro.count(buf) > n {
+				// never split a line ending or an encoded character
+				start := len(buf) - n
+				if ro.Runes {
+					start = len(buf) - runeSuffixLen(buf, n)
+				}
+				if max := len(buf) - len(ro.eol); start > max {
+					start = max
+				}
+				for start < len(buf) && !utf8.RuneStart(buf[start]) {
+					start++
+				}
+				buf = buf[start:]
+			}
+			if len(ro.Decorators) > 0 {
+				buf = ro.decorate(buf)
+			}
 		}
+
+		var nr int
+		nr, err = w.Write(buf)
+		written += ro.count(buf[:nr])
 		if err != nil {
-			return err
+			return written, err
 		}
-		n -= nr
+		n -= ro.count(buf[:nr])
 	}
-	return nil
+	return written, nil
+}
+
+// count returns the number of characters, or with Lines the number of line
+// endings, in b.
+func (ro *RandomOutput) count(b []byte) int {
+	switch {
+	case ro.Runes:
+		return utf8.RuneCount(b)
+	case ro.Lines:
+		return bytes.Count(b, []byte(ro.eol))
+	}
+	return len(b)
+}
+
+// runeSuffixLen returns the length in bytes of the last n encoded characters
+// of b.
+func runeSuffixLen(b []byte, n int) int {
+	i := len(b)
+	for ; n > 0 && i > 0; n-- {
+		_, size := utf8.DecodeLastRune(b[:i])
+		i -= size
+	}
+	return len(b) - i
+}
+
+// decorate returns a line with the same length as buf, if possible, that
+// contains the line decorations and as much of buf as fits.
+func (ro *RandomOutput) decorate(buf []byte) []byte {
+	var prefix, suffix []byte
+	for _, d := range ro.Decorators {
+		prefix, suffix = d(prefix, suffix)
+	}
+
+	end := len(buf) - len(ro.eol)
+	body := end - len(prefix) - len(suffix)
+	if body < 0 {
+		body = 0
+	}
+
+	line := append(ro.scratch[:0], prefix...)
+	line = append(line, buf[end-body:end]...)
+	line = append(line, suffix...)
+	line = append(line, ro.eol...)
+	ro.scratch = line
+	return line
+}
+
+// generate returns a line from the source with the line decorations.
+func (ro *RandomOutput) generate() []byte {
+	var prefix, suffix []byte
+	for _, d := range ro.Decorators {
+		prefix, suffix = d(prefix, suffix)
+	}
+
+	line := append(ro.scratch[:0], prefix...)
+	line = ro.Source.Line(line, ro.r)
+	line = append(line, suffix...)
+	line = append(line, ro.eol...)
+	ro.scratch = line
+	return line
 }
 
 func (ro *RandomOutput) pickBuffer() []byte {
@@ -212,26 +1583,32 @@ func (ro *RandomOutput) pickBuffer() []byte {
 }
 
 func parseRate(rate string) (int64, error) {
-	if rate == "" {
-		return 0, fmt.Errorf("invalid rate: rate must be non-empty")
+	return parseScaled("rate", rate)
+}
+
+// parseScaled parses an integer with an optional k, m, or g suffix. The name
+// describes the value in error messages.
+func parseScaled(name, value string) (int64, error) {
+	if value == "" {
+		return 0, fmt.Errorf("invalid %s: %s must be non-empty", name, name)
 	}
 
 	scale := int64(1)
-	switch rate[len(rate)-1] {
+	switch value[len(value)-1] {
 	case 'k', 'K':
-		rate = rate[:len(rate)-1]
+		value = value[:len(value)-1]
 		scale = 1000
 	case 'm', 'M':
-		rate = rate[:len(rate)-1]
+		value = value[:len(value)-1]
 		scale = 1000000
 	case 'g', 'G':
-		rate = rate[:len(rate)-1]
+		value = value[:len(value)-1]
 		scale = 1000000000
 	}
 
-	base, err := strconv.ParseInt(rate, 10, 64)
+	base, err := strconv.ParseInt(value, 10, 64)
 	if err != nil {
-		return 0, fmt.Errorf("invalid rate: %w", err)
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
 	}
 	return scale * base, nil
 }
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files with the current output")
+
+// runEnv makes the test binary run rndout instead of the tests, so that tests
+// can run it with flags like a user would
+const runEnv = "RNDOUT_TEST_RUN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(runEnv) != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// TestSeedOutput checks that runs with a fixed seed write the same bytes as
+// the golden files in testdata/golden. Each run lasts 9.5 steps, so timing
+// does not change the number of steps it completes.
+//
+// Content with wall-clock timestamps is not covered.
+func TestSeedOutput(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"logistic", nil},
+		{"ramp", []string{"-mode", "ramp", "-ramp-duration", "500ms"}},
+		{"seasonal", []string{"-mode", "seasonal", "-season", "400ms:0.5", "-noise", "0.2"}},
+		{"replay", []string{"-mode", "replay", "-replay", "testdata/record.csv"}},
+		{"jitter", []string{"-jitter", "20ms"}},
+		{"skips", []string{"-slice-length", "4", "-skips", "1", "-skip-probability", "0.5"}},
+		{"sequence", []string{"-sequence"}},
+		{"english", []string{"-text", "english"}},
+		{"crlf", []string{"-crlf", "-block-size", "40"}},
+		{"statsd", []string{"-content", "statsd"}},
+		{"avro", []string{"-content", "avro", "-schema", "testdata/event.avsc"}},
+		{"protobuf", []string{"-content", "protobuf", "-schema", "testdata/event.proto"}},
+		{"json-schema", []string{"-content", "json-schema", "-schema", "testdata/event.schema.json"}},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			args := append([]string{"-seed", "42", "-rate", "2k", "-step-size", "100ms", "-duration", "950ms"}, test.args...)
+			cmd := exec.Command(os.Args[0], args...)
+			cmd.Env = append(os.Environ(), runEnv+"=1")
+			var stderr bytes.Buffer
+			cmd.Stderr = &stderr
+			out, err := cmd.Output()
+			if err != nil {
+				t.Fatalf("rndout %v failed: %v\n%s", args, err, stderr.Bytes())
+			}
+
+			golden := filepath.Join("testdata", "golden", test.name+".out")
+			if *update {
+				if err := os.WriteFile(golden, out, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(out, want) {
+				t.Errorf("output differs from %s: got %d bytes, want %d; rerun with -update if the change is intended", golden, len(out), len(want))
+			}
+		})
+	}
+}
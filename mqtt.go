@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// MQTT 3.1.1 control packet types, shifted into the high bits of the first
+// byte of the fixed header.
+const (
+	mqttConnect = 1 << 4
+	mqttConnack = 2 << 4
+	mqttPublish = 3 << 4
+	mqttPuback  = 4 << 4
+	mqttPubrec  = 5 << 4
+	mqttPubrel  = 6<<4 | 2
+	mqttPubcomp = 7 << 4
+)
+
+// mqttMaxInflight is the maximum number of messages sent before waiting for
+// their acknowledgements. It is well below the number of packet IDs, so IDs
+// are never reused while a message is in flight.
+const mqttMaxInflight = 1000
+
+// MQTTOptions configure an MQTT sink.
+type MQTTOptions struct {
+	Addr     string
+	Topic    string
+	QoS      int
+	Retain   bool
+	TLS      bool
+	ClientID string
+	Username string
+	Password string
+}
+
+// MQTTSink publishes each line as a message using MQTT 3.1.1, encoding the
+// protocol directly. With QoS 1 or 2, it sends up to mqttMaxInflight messages
+// before waiting for the broker's acknowledgements.
+type MQTTSink struct {
+	opts MQTTOptions
+	eol  string
+
+	conn     net.Conn
+	br       *bufio.Reader
+	bw       *bufio.Writer
+	packetID uint16
+	pkt      []byte
+}
+
+func NewMQTTSink(opts MQTTOptions, eol string) *MQTTSink {
+	return &MQTTSink{opts: opts, eol: eol}
+}
+
+// Write publishes the lines in p. The connection is opened on the first
+// write and after any error.
+func (s *MQTTSink) Write(p []byte) (int, error) {
+	if s.conn == nil {
+		if err := s.connect(); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := s.publish(strings.Split(strings.TrimSuffix(string(p), s.eol), s.eol)); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s *MQTTSink) connect() error {
+	var conn net.Conn
+	var err error
+	if s.opts.TLS {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: sinkTimeout}, "tcp", s.opts.Addr, nil)
+	} else {
+		conn, err = net.DialTimeout("tcp", s.opts.Addr, sinkTimeout)
+	}
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	s.br = bufio.NewReader(conn)
+	s.bw = bufio.NewWriter(conn)
+
+	// the keep alive is disabled, as steps without output may be longer
+	// than any reasonable interval
+	flags := byte(0x02) // clean session
+	var payload []byte
+	payload = mqttAppendString(payload, s.opts.ClientID)
+	if s.opts.Username != "" {
+		flags |= 0x80
+		payload = mqttAppendString(payload, s.opts.Username)
+	}
+	if s.opts.Password != "" {
+		flags |= 0x40
+		payload = mqttAppendString(payload, s.opts.Password)
+	}
+	body := mqttAppendString(nil, "MQTT")
+	body = append(body, 4, flags, 0, 0)
+	body = append(body, payload...)
+
+	conn.SetDeadline(time.Now().Add(sinkTimeout))
+	s.writePacket(mqttConnect, body)
+	if err := s.bw.Flush(); err != nil {
+		return s.fail(err)
+	}
+
+	typ, ack, err := s.readPacket()
+	if err != nil {
+		return s.fail(err)
+	}
+	if typ != mqttConnack || len(ack) != 2 {
+		return s.fail(fmt.Errorf("mqtt: expected CONNACK, got packet type %d", typ>>4))
+	}
+	if ack[1] != 0 {
+		return s.fail(fmt.Errorf("mqtt: connection refused with return code %d", ack[1]))
+	}
+	return nil
+}
+
+// fail closes the connection after an error while connecting.
+func (s *MQTTSink) fail(err error) error {
+	s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+func (s *MQTTSink) publish(lines []string) error {
+	for len(lines) > 0 {
+		batch := lines
+		if len(batch) > mqttMaxInflight {
+			batch = batch[:mqttMaxInflight]
+		}
+		if err := s.publishBatch(batch); err != nil {
+			return err
+		}
+		lines = lines[len(batch):]
+	}
+	return nil
+}
+
+func (s *MQTTSink) publishBatch(lines []string) error {
+	s.conn.SetDeadline(time.Now().Add(sinkTimeout))
+
+	header := byte(mqttPublish) | byte(s.opts.QoS)<<1
+	if s.opts.Retain {
+		header |= 1
+	}
+
+	ids := make([]uint16, len(lines))
+	for i, line := range lines {
+		body := mqttAppendString(s.pkt[:0], s.opts.Topic)
+		if s.opts.QoS > 0 {
+			ids[i] = s.nextPacketID()
+			body = append(body, byte(ids[i]>>8), byte(ids[i]))
+		}
+		body = append(body, line...)
+		s.pkt = body
+		s.writePacket(header, body)
+	}
+	if err := s.bw.Flush(); err != nil {
+		return err
+	}
+
+	switch s.opts.QoS {
+	case 1:
+		return s.awaitAcks(mqttPuback, ids)
+	case 2:
+		if err := s.awaitAcks(mqttPubrec, ids); err != nil {
+			return err
+		}
+		for _, id := range ids {
+			s.writePacket(mqttPubrel, []byte{byte(id >> 8), byte(id)})
+		}
+		if err := s.bw.Flush(); err != nil {
+			return err
+		}
+		return s.awaitAcks(mqttPubcomp, ids)
+	}
+	return nil
+}
+
+// awaitAcks reads an acknowledgement of the given type for each packet ID.
+func (s *MQTTSink) awaitAcks(typ byte, ids []uint16) error {
+	pending := make(map[uint16]bool, len(ids))
+	for _, id := range ids {
+		pending[id] = true
+	}
+	for len(pending) > 0 {
+		t, body, err := s.readPacket()
+		if err != nil {
+			return err
+		}
+		if t != typ || len(body) != 2 {
+			return fmt.Errorf("mqtt: unexpected packet type %d while waiting for acknowledgements", t>>4)
+		}
+		delete(pending, uint16(body[0])<<8|uint16(body[1]))
+	}
+	return nil
+}
+
+func (s *MQTTSink) nextPacketID() uint16 {
+	if s.packetID++; s.packetID == 0 {
+		s.packetID = 1
+	}
+	return s.packetID
+}
+
+func (s *MQTTSink) writePacket(header byte, body []byte) {
+	s.bw.WriteByte(header)
+	// the remaining length uses the same encoding as a protobuf varint
+	var length [4]byte
+	s.bw.Write(protoAppendVarint(length[:0], uint64(len(body))))
+	s.bw.Write(body)
+}
+
+// readPacket returns the type of the next packet, with the flags cleared,
+// and its body.
+func (s *MQTTSink) readPacket() (byte, []byte, error) {
+	header, err := s.br.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	length := 0
+	for shift := 0; ; shift += 7 {
+		if shift > 21 {
+			return 0, nil, errors.New("mqtt: invalid remaining length")
+		}
+		b, err := s.br.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length |= int(b&0x7f) << shift
+		if b < 0x80 {
+			break
+		}
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.br, body); err != nil {
+		return 0, nil, err
+	}
+	return header & 0xf0, body, nil
+}
+
+func mqttAppendString(b []byte, s string) []byte {
+	b = append(b, byte(len(s)>>8), byte(len(s)))
+	return append(b, s...)
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	OTLPProtocolHTTP = "http/protobuf"
+	OTLPProtocolGRPC = "grpc"
+)
+
+// OTLP log severity for generated records.
+const (
+	otlpSeverityInfo = 9
+)
+
+// gRPC methods of the OTLP collector services.
+const (
+	otlpLogsMethod   = "/opentelemetry.proto.collector.logs.v1.LogsService/Export"
+	otlpTracesMethod = "/opentelemetry.proto.collector.trace.v1.TraceService/Export"
+)
+
+// OTLPSink sends each write as a batch of log records in an OTLP/HTTP
+// ExportLogsServiceRequest, encoded as protobuf. Each line is the body of one
+// record. If Spans is set, the sink instead sends each line as a span in an
+// ExportTraceServiceRequest.
+type OTLPSink struct {
+	Spans *SpanTree
+
+	// GRPC, if true, sends requests to the Export method of the collector's
+	// gRPC service at url instead of posting them to url. The standard
+	// library's HTTP/2 client only connects over TLS, so url must use https.
+	GRPC bool
+
+	url    string
+	header http.Header
+	client *http.Client
+	eol    string
+
+	// resource and scope are the encoded Resource and InstrumentationScope
+	// messages, which are the same for every request
+	resource []byte
+	scope    []byte
+
+	items []byte
+	item  []byte
+	msg   []byte
+}
+
+// NewOTLPSink creates a sink that posts to url, which is usually the
+// collector's /v1/logs or /v1/traces endpoint. Headers have the form
+// "Name: value" and resource attributes have the form "key=value".
+func NewOTLPSink(url string, headers, resource []string, scope, eol string) (*OTLPSink, error) {
+	h := make(http.Header)
+	h.Set("Content-Type", "application/x-protobuf")
+	h.Set("User-Agent", "rndout")
+	if err := addHeaders(h, "OTLP", headers); err != nil {
+		return nil, err
+	}
+
+	var res []byte
+	for _, attr := range resource {
+		key, value, ok := strings.Cut(attr, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid OTLP resource attribute %q: must have the form 'key=value'", attr)
+		}
+		res = otlpAppendAttribute(res, 1, key, value)
+	}
+
+	return &OTLPSink{
+		url:      url,
+		header:   h,
+		client:   &http.Client{Timeout: sinkTimeout},
+		eol:      eol,
+		resource: res,
+		scope:    protoAppendString(nil, 1, scope),
+	}, nil
+}
+
+// Write sends the lines in p as one request.
+func (s *OTLPSink) Write(p []byte) (int, error) {
+	now := time.Now()
+
+	// ScopeLogs and ScopeSpans have the same layout, as do ResourceLogs and
+	// ResourceSpans and the two export requests
+	//
+	//	message ScopeLogs { InstrumentationScope scope = 1; repeated LogRecord log_records = 2; }
+	//	message ResourceLogs { Resource resource = 1; repeated ScopeLogs scope_logs = 2; }
+	//	message ExportLogsServiceRequest { repeated ResourceLogs resource_logs = 1; }
+	s.items = protoAppendMessage(s.items[:0], 1, s.scope)
+	for _, line := range strings.Split(strings.TrimSuffix(string(p), s.eol), s.eol) {
+		if s.Spans != nil {
+			s.item = s.Spans.appendSpan(s.item[:0], line, now)
+		} else {
+			s.item = appendLogRecord(s.item[:0], line, now)
+		}
+		s.items = protoAppendMessage(s.items, 2, s.item)
+	}
+
+	resourceItems := protoAppendMessage(nil, 1, s.resource)
+	resourceItems = protoAppendMessage(resourceItems, 2, s.items)
+	s.msg = protoAppendMessage(s.msg[:0], 1, resourceItems)
+
+	if err := s.post(); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// appendLogRecord appends an INFO LogRecord with line as the body.
+//
+//	message LogRecord {
+//	  fixed64 time_unix_nano = 1; SeverityNumber severity_number = 2;
+//	  string severity_text = 3; AnyValue body = 5;
+//	  fixed64 observed_time_unix_nano = 11;
+//	}
+func appendLogRecord(b []byte, line string, now time.Time) []byte {
+	b = protoAppendTag(b, 1, 1)
+	b = protoAppendFixed64(b, uint64(now.UnixNano()))
+	b = protoAppendTag(b, 2, 0)
+	b = protoAppendVarint(b, otlpSeverityInfo)
+	b = protoAppendString(b, 3, "INFO")
+	b = otlpAppendStringValue(b, 5, line)
+	b = protoAppendTag(b, 11, 1)
+	return protoAppendFixed64(b, uint64(now.UnixNano()))
+}
+
+func (s *OTLPSink) post() error {
+	if s.GRPC {
+		return s.call()
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(s.msg))
+	if err != nil {
+		return err
+	}
+	req.Header = s.header.Clone()
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	// drain the body so the connection is reused
+	_, _ = io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		err := fmt.Errorf("OTLP endpoint returned %s", res.Status)
+		switch res.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return transientError{err}
+		}
+		return err
+	}
+	return nil
+}
+
+// call sends the request as a unary gRPC call.
+func (s *OTLPSink) call() error {
+	method := otlpLogsMethod
+	if s.Spans != nil {
+		method = otlpTracesMethod
+	}
+
+	// gRPC messages are prefixed with a compression flag and their length
+	body := make([]byte, 5, 5+len(s.msg))
+	binary.BigEndian.PutUint32(body[1:], uint32(len(s.msg)))
+	body = append(body, s.msg...)
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(s.url, "/")+method, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header = s.header.Clone()
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	// the status is in the trailers, which are set after reading the body
+	_, _ = io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+
+	if res.ProtoMajor != 2 {
+		return fmt.Errorf("OTLP endpoint returned %s over %s, but gRPC requires HTTP/2", res.Status, res.Proto)
+	}
+	if res.StatusCode != http.StatusOK {
+		err := fmt.Errorf("OTLP endpoint returned %s", res.Status)
+		switch res.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return transientError{err}
+		}
+		return err
+	}
+
+	// responses without a message have the status in the headers
+	status, msg := res.Trailer.Get("Grpc-Status"), res.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status, msg = res.Header.Get("Grpc-Status"), res.Header.Get("Grpc-Message")
+	}
+	switch status {
+	case "0":
+		return nil
+	case "":
+		return errors.New("OTLP endpoint returned no gRPC status")
+	}
+	if m, err := url.PathUnescape(msg); err == nil {
+		msg = m
+	}
+	err = fmt.Errorf("OTLP endpoint returned gRPC status %s: %s", status, msg)
+
+	// the retryable codes in the OTLP specification: CANCELLED,
+	// DEADLINE_EXCEEDED, ABORTED, OUT_OF_RANGE, UNAVAILABLE, and DATA_LOSS
+	switch status {
+	case "1", "4", "10", "11", "14", "15":
+		return transientError{err}
+	}
+	return err
+}
+
+// otlpAppendAttribute appends a KeyValue with a string value as the given
+// field.
+//
+//	message KeyValue { string key = 1; AnyValue value = 2; }
+func otlpAppendAttribute(b []byte, field int, key, value string) []byte {
+	kv := protoAppendString(nil, 1, key)
+	kv = otlpAppendStringValue(kv, 2, value)
+	return protoAppendMessage(b, field, kv)
+}
+
+// otlpAppendStringValue appends an AnyValue with a string value as the given
+// field.
+//
+//	message AnyValue { oneof value { string string_value = 1; ... } }
+func otlpAppendStringValue(b []byte, field int, s string) []byte {
+	b = protoAppendTag(b, field, 2)
+	b = protoAppendVarint(b, uint64(protoStringSize(s)))
+	return protoAppendString(b, 1, s)
+}
@@ -0,0 +1,600 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Parquet physical and converted types, from the Parquet format's Thrift
+// definitions.
+const (
+	parquetBoolean   = 0
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetUTF8            = 0
+	parquetTimestampMillis = 9
+	parquetJSON            = 19
+)
+
+// ParquetColumn is a column of generated events.
+type ParquetColumn struct {
+	Name          string
+	Type          int
+	ConvertedType int // -1 if none
+}
+
+// parquetColumns lists every field that events can have. Fields not set by an
+// event's type are null.
+var parquetColumns = []ParquetColumn{
+	{"ts", parquetInt64, parquetTimestampMillis},
+	{"type", parquetByteArray, parquetUTF8},
+	{"method", parquetByteArray, parquetUTF8},
+	{"path", parquetByteArray, parquetUTF8},
+	{"status", parquetInt64, -1},
+	{"duration_ms", parquetDouble, -1},
+	{"bytes", parquetInt64, -1},
+	{"client_ip", parquetByteArray, parquetUTF8},
+	{"level", parquetByteArray, parquetUTF8},
+	{"service", parquetByteArray, parquetUTF8},
+	{"error", parquetByteArray, parquetUTF8},
+	{"code", parquetByteArray, parquetUTF8},
+	{"retryable", parquetBoolean, -1},
+	{"user", parquetByteArray, parquetUTF8},
+	{"action", parquetByteArray, parquetUTF8},
+	{"resource", parquetByteArray, parquetUTF8},
+	{"success", parquetBoolean, -1},
+	{"message", parquetByteArray, parquetUTF8},
+}
+
+func parquetMain(args []string) {
+	fs := flag.NewFlagSet("parquet", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: rndout parquet [flags] file")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Write generated events to a Parquet file as fast as possible. Events have the")
+		fmt.Fprintln(fs.Output(), "same types and values as '-content json', with timestamps spread evenly over")
+		fmt.Fprintln(fs.Output(), "the time span. Each event type sets some of the columns; the others are null.")
+		fmt.Fprintln(fs.Output(), "With -schema, rows are records generated from a JSON Schema instead, with a")
+		fmt.Fprintln(fs.Output(), "column for each property. Columns are not compressed.")
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+
+	rowsFlag := fs.String("rows", "100k", "number of rows to write")
+	rowGroupSize := fs.Int("row-group-size", 10000, "number of rows in each row group")
+	var columns listFlag
+	fs.Var(&columns, "column", "column to include, one of 'ts', 'type', 'message', or a field of an event type, or with -schema a property; may be repeated; if not set, include all columns")
+	schemaFile := fs.String("schema", "", "JSON Schema of an object describing the rows; each property is a column, and properties with object, array, or mixed types are JSON text; if empty, write events")
+	events := fs.String("events", "request=8,error=1,audit=1", "comma-separated event types, each with an optional relative weight; types are 'request', 'error', and 'audit'; not used with -schema")
+	messageSize := fs.Int("message-size", 64, "number of random characters in each message; not used with -schema")
+	span := fs.Duration("span", time.Hour, "length of time covered by the rows; not used with -schema")
+	endTime := fs.String("end", "", "time of the last row, in RFC 3339 format; if empty, use the current time; not used with -schema")
+	seed := fs.Int64("seed", 0, "seed for all random decisions; if 0, use the current time")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	rows, err := parseScaled("rows", *rowsFlag)
+	if err != nil {
+		die(err)
+	}
+	if rows < 0 {
+		die("invalid rows: must not be negative")
+	}
+	if *rowGroupSize < 1 {
+		die("invalid row group size: must be at least 1")
+	}
+	if *messageSize < 0 {
+		die("invalid message size: must not be negative")
+	}
+	if *span < 0 {
+		die("invalid span: must not be negative")
+	}
+	mix, err := ParseEventMix(*events)
+	if err != nil {
+		die(err)
+	}
+
+	all := parquetColumns
+	var schema *JSONSchema
+	if *schemaFile != "" {
+		if schema, err = ReadJSONSchema(*schemaFile); err != nil {
+			die(err)
+		}
+		if all, err = ParquetSchemaColumns(schema); err != nil {
+			die(fmt.Errorf("invalid schema: %w", err))
+		}
+	}
+	cols := all
+	if len(columns) > 0 {
+		cols = nil
+		for _, name := range columns {
+			i := 0
+			for i < len(all) && all[i].Name != name {
+				i++
+			}
+			if i == len(all) {
+				if schema != nil {
+					die(fmt.Sprintf("invalid column %q: not a property of the schema", name))
+				}
+				die(fmt.Sprintf("invalid column %q: not a field of any event type", name))
+			}
+			cols = append(cols, all[i])
+		}
+	}
+
+	end := time.Now()
+	if *endTime != "" {
+		if end, err = time.Parse(time.RFC3339Nano, *endTime); err != nil {
+			die(fmt.Errorf("invalid end: %w", err))
+		}
+	}
+
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	r := rand.New(rand.NewSource(*seed))
+
+	f, err := os.Create(fs.Arg(0))
+	if err != nil {
+		die(err)
+	}
+	pw := NewParquetWriter(f, cols, *rowGroupSize)
+
+	var step time.Duration
+	if rows > 1 {
+		step = *span / time.Duration(rows-1)
+	}
+	start := end.Add(-*span)
+	var fields []EventField
+	var record []byte
+	for i := int64(0); i < rows; i++ {
+		if schema != nil {
+			record = schema.Append(record[:0], r)
+			if fields, err = ParquetRecordFields(fields[:0], cols, record); err != nil {
+				die(err)
+			}
+			if err := pw.Write(fields); err != nil {
+				die(err)
+			}
+			continue
+		}
+
+		t := mix.pick(r)
+		fields = append(fields[:0],
+			EventField{"ts", start.Add(time.Duration(i)*step).UnixNano() / 1e6},
+			EventField{"type", t.Name},
+		)
+		fields = t.Fields(fields, r)
+		fields = append(fields, EventField{"message", randomString(r, *messageSize)})
+		if err := pw.Write(fields); err != nil {
+			die(err)
+		}
+	}
+	if err := pw.Close(); err != nil {
+		die(err)
+	}
+	if err := f.Close(); err != nil {
+		die(err)
+	}
+}
+
+// ParquetSchemaColumns returns a column for each property of a JSON Schema of
+// an object, in the order of the properties. Properties with a single integer,
+// number, boolean, or string type are columns of that type, and others hold
+// their values as JSON text.
+func ParquetSchemaColumns(s *JSONSchema) ([]ParquetColumn, error) {
+	if len(s.Variants) > 0 || len(s.Types) != 1 || s.Types[0] != "object" {
+		return nil, errors.New("rows must be objects")
+	}
+	var cols []ParquetColumn
+	for _, p := range s.Properties {
+		col := ParquetColumn{Name: p.Name, Type: parquetByteArray, ConvertedType: parquetJSON}
+		switch parquetValueType(p.Schema) {
+		case "integer":
+			col.Type, col.ConvertedType = parquetInt64, -1
+		case "number":
+			col.Type, col.ConvertedType = parquetDouble, -1
+		case "boolean":
+			col.Type, col.ConvertedType = parquetBoolean, -1
+		case "string":
+			col.ConvertedType = parquetUTF8
+		}
+		cols = append(cols, col)
+	}
+	return cols, nil
+}
+
+// parquetValueType returns the JSON Schema type of all the non-null values
+// of a schema, or "" if they have several types or are objects or arrays.
+// Integers and numbers together are numbers.
+func parquetValueType(s *JSONSchema) string {
+	if len(s.Variants) > 0 {
+		return ""
+	}
+
+	types := s.Types
+	if len(s.Enum) > 0 {
+		types = nil
+		for _, v := range s.Enum {
+			switch {
+			case string(v) == "null":
+			case string(v) == "true" || string(v) == "false":
+				types = append(types, "boolean")
+			case v[0] == '"':
+				types = append(types, "string")
+			case v[0] == '{' || v[0] == '[':
+				return ""
+			default:
+				if _, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+					types = append(types, "integer")
+				} else {
+					types = append(types, "number")
+				}
+			}
+		}
+	} else if len(types) == 0 {
+		return "string"
+	}
+
+	t := ""
+	for _, u := range types {
+		switch {
+		case u == "null":
+		case u == "object" || u == "array":
+			return ""
+		case t == "" || t == u:
+			t = u
+		case (t == "integer" || t == "number") && (u == "integer" || u == "number"):
+			t = "number"
+		default:
+			return ""
+		}
+	}
+	return t
+}
+
+// ParquetRecordFields appends the fields of a JSON object for the columns to
+// dst. Missing and null values are not appended.
+func ParquetRecordFields(dst []EventField, cols []ParquetColumn, record []byte) ([]EventField, error) {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(record, &m); err != nil {
+		return nil, err
+	}
+	for _, col := range cols {
+		raw, ok := m[col.Name]
+		if !ok || string(raw) == "null" {
+			continue
+		}
+
+		var value interface{}
+		var err error
+		switch {
+		case col.Type == parquetInt64:
+			var n int64
+			if n, err = strconv.ParseInt(string(raw), 10, 64); err != nil {
+				// integers can have a zero fraction, like 5.0
+				var f float64
+				if f, err = strconv.ParseFloat(string(raw), 64); err == nil {
+					n = int64(f)
+				}
+			}
+			value = n
+		case col.Type == parquetDouble:
+			value, err = strconv.ParseFloat(string(raw), 64)
+		case col.Type == parquetBoolean:
+			value = string(raw) == "true"
+		case col.ConvertedType == parquetUTF8:
+			var str string
+			err = json.Unmarshal(raw, &str)
+			value = str
+		default:
+			value = string(raw)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for column %s: %w", col.Name, err)
+		}
+		dst = append(dst, EventField{col.Name, value})
+	}
+	return dst, nil
+}
+
+// ParquetWriter writes rows to a Parquet file. Each column chunk is a single
+// uncompressed data page with plain encoding. All columns are optional.
+type ParquetWriter struct {
+	w            *bufio.Writer
+	columns      []ParquetColumn
+	rowGroupSize int
+
+	offset    int64
+	rows      int64
+	groups    []parquetRowGroup
+	chunks    []parquetChunk
+	groupRows int
+}
+
+type parquetChunk struct {
+	defs   []byte // definition levels, 1 if the value is set
+	values []byte
+	bools  int // number of boolean values, which are bit-packed
+}
+
+type parquetRowGroup struct {
+	rows    int
+	size    int64
+	offsets []int64
+	sizes   []int64
+	values  []int
+}
+
+func NewParquetWriter(w io.Writer, columns []ParquetColumn, rowGroupSize int) *ParquetWriter {
+	return &ParquetWriter{
+		w:            bufio.NewWriterSize(w, 64*1024),
+		columns:      columns,
+		rowGroupSize: rowGroupSize,
+		chunks:       make([]parquetChunk, len(columns)),
+	}
+}
+
+// Write adds a row. Fields that do not match a column are ignored and
+// columns without a matching field are null.
+func (pw *ParquetWriter) Write(fields []EventField) error {
+	if pw.offset == 0 {
+		if err := pw.write([]byte("PAR1")); err != nil {
+			return err
+		}
+	}
+
+	for i, col := range pw.columns {
+		c := &pw.chunks[i]
+		var value interface{}
+		for _, f := range fields {
+			if f.Name == col.Name {
+				value = f.Value
+				break
+			}
+		}
+		if value == nil {
+			c.defs = append(c.defs, 0)
+			continue
+		}
+		c.defs = append(c.defs, 1)
+
+		switch v := value.(type) {
+		case string:
+			n := uint32(len(v))
+			c.values = append(c.values, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+			c.values = append(c.values, v...)
+		case int64:
+			c.values = protoAppendFixed64(c.values, uint64(v))
+		case float64:
+			c.values = protoAppendFixed64(c.values, math.Float64bits(v))
+		case bool:
+			if c.bools%8 == 0 {
+				c.values = append(c.values, 0)
+			}
+			if v {
+				c.values[len(c.values)-1] |= 1 << (c.bools % 8)
+			}
+			c.bools++
+		}
+	}
+
+	pw.rows++
+	if pw.groupRows++; pw.groupRows == pw.rowGroupSize {
+		return pw.flushRowGroup()
+	}
+	return nil
+}
+
+func (pw *ParquetWriter) flushRowGroup() error {
+	g := parquetRowGroup{rows: pw.groupRows}
+	for i := range pw.chunks {
+		c := &pw.chunks[i]
+
+		// the definition levels use the RLE hybrid encoding with a bit width
+		// of 1 and a run for each group of equal levels
+		var levels []byte
+		for j := 0; j < len(c.defs); {
+			k := j
+			for k < len(c.defs) && c.defs[k] == c.defs[j] {
+				k++
+			}
+			levels = protoAppendVarint(levels, uint64(k-j)<<1)
+			levels = append(levels, c.defs[j])
+			j = k
+		}
+		n := uint32(len(levels))
+		data := append([]byte{byte(n), byte(n >> 8), byte(n >> 16), byte(n >> 24)}, levels...)
+		data = append(data, c.values...)
+
+		var t thriftWriter
+		t.begin()
+		t.i32(1, 0) // DATA_PAGE
+		t.i32(2, int32(len(data)))
+		t.i32(3, int32(len(data)))
+		t.beginStruct(5)
+		t.i32(1, int32(len(c.defs)))
+		t.i32(2, 0) // PLAIN
+		t.i32(3, 3) // RLE
+		t.i32(4, 3) // RLE
+		t.end()
+		t.end()
+
+		g.offsets = append(g.offsets, pw.offset)
+		g.sizes = append(g.sizes, int64(len(t.b)+len(data)))
+		g.values = append(g.values, len(c.defs))
+		g.size += int64(len(t.b) + len(data))
+		if err := pw.write(t.b); err != nil {
+			return err
+		}
+		if err := pw.write(data); err != nil {
+			return err
+		}
+		*c = parquetChunk{defs: c.defs[:0], values: c.values[:0]}
+	}
+	pw.groups = append(pw.groups, g)
+	pw.groupRows = 0
+	return nil
+}
+
+func (pw *ParquetWriter) write(b []byte) error {
+	n, err := pw.w.Write(b)
+	pw.offset += int64(n)
+	return err
+}
+
+// Close writes the last row group and the file metadata. It does not close
+// the underlying writer.
+func (pw *ParquetWriter) Close() error {
+	if pw.offset == 0 {
+		if err := pw.write([]byte("PAR1")); err != nil {
+			return err
+		}
+	}
+	if pw.groupRows > 0 {
+		if err := pw.flushRowGroup(); err != nil {
+			return err
+		}
+	}
+
+	var t thriftWriter
+	t.begin()
+	t.i32(1, 1)
+	t.list(2, thriftStruct, len(pw.columns)+1)
+	t.begin()
+	t.binary(4, "schema")
+	t.i32(5, int32(len(pw.columns)))
+	t.end()
+	for _, col := range pw.columns {
+		t.begin()
+		t.i32(1, int32(col.Type))
+		t.i32(3, 1) // OPTIONAL
+		t.binary(4, col.Name)
+		if col.ConvertedType >= 0 {
+			t.i32(6, int32(col.ConvertedType))
+		}
+		t.end()
+	}
+	t.i64(3, pw.rows)
+	t.list(4, thriftStruct, len(pw.groups))
+	for _, g := range pw.groups {
+		t.begin()
+		t.list(1, thriftStruct, len(pw.columns))
+		for i, col := range pw.columns {
+			t.begin()
+			t.i64(2, g.offsets[i])
+			t.beginStruct(3)
+			t.i32(1, int32(col.Type))
+			t.list(2, thriftI32, 2)
+			t.b = avroAppendLong(t.b, 0) // PLAIN
+			t.b = avroAppendLong(t.b, 3) // RLE
+			t.list(3, thriftBinary, 1)
+			t.b = protoAppendVarint(t.b, uint64(len(col.Name)))
+			t.b = append(t.b, col.Name...)
+			t.i32(4, 0) // UNCOMPRESSED
+			t.i64(5, int64(g.values[i]))
+			t.i64(6, g.sizes[i])
+			t.i64(7, g.sizes[i])
+			t.i64(9, g.offsets[i])
+			t.end()
+			t.end()
+		}
+		t.i64(2, g.size)
+		t.i64(3, int64(g.rows))
+		t.end()
+	}
+	t.binary(6, "rndout")
+	t.end()
+
+	n := uint32(len(t.b))
+	t.b = append(t.b, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+	t.b = append(t.b, "PAR1"...)
+	if err := pw.write(t.b); err != nil {
+		return err
+	}
+	return pw.w.Flush()
+}
+
+// Thrift compact protocol types.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes structs with the Thrift compact protocol, which
+// Parquet uses for its metadata. Integers are zig-zag varints, like Avro
+// longs.
+type thriftWriter struct {
+	b    []byte
+	last []int // the last field ID of each open struct
+}
+
+// begin starts a struct that is not a field, like a list element.
+func (t *thriftWriter) begin() {
+	t.last = append(t.last, 0)
+}
+
+func (t *thriftWriter) end() {
+	t.b = append(t.b, 0)
+	t.last = t.last[:len(t.last)-1]
+}
+
+func (t *thriftWriter) field(id int, typ byte) {
+	last := &t.last[len(t.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		t.b = append(t.b, byte(delta)<<4|typ)
+	} else {
+		t.b = append(t.b, typ)
+		t.b = avroAppendLong(t.b, int64(id))
+	}
+	*last = id
+}
+
+func (t *thriftWriter) beginStruct(id int) {
+	t.field(id, thriftStruct)
+	t.begin()
+}
+
+func (t *thriftWriter) i32(id int, v int32) {
+	t.field(id, thriftI32)
+	t.b = avroAppendLong(t.b, int64(v))
+}
+
+func (t *thriftWriter) i64(id int, v int64) {
+	t.field(id, thriftI64)
+	t.b = avroAppendLong(t.b, v)
+}
+
+func (t *thriftWriter) binary(id int, s string) {
+	t.field(id, thriftBinary)
+	t.b = protoAppendVarint(t.b, uint64(len(s)))
+	t.b = append(t.b, s...)
+}
+
+// list starts a list field with n elements, which the caller appends.
+func (t *thriftWriter) list(id int, elem byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.b = append(t.b, byte(n)<<4|elem)
+	} else {
+		t.b = append(t.b, 0xf0|elem)
+		t.b = protoAppendVarint(t.b, uint64(n))
+	}
+}
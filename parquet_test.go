@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// The reader in this file follows the Parquet format specification without
+// sharing code with ParquetWriter, so that the round trip checks the file
+// against the format instead of against the writer's own assumptions.
+
+// thriftReader decodes the Thrift compact protocol. Structs decode to maps
+// from field IDs to values, lists to slices, integers to int64, and binary
+// to []byte.
+type thriftReader struct {
+	b   []byte
+	err error
+}
+
+func (t *thriftReader) byte() byte {
+	if len(t.b) == 0 {
+		t.err = fmt.Errorf("unexpected end of data")
+		return 0
+	}
+	c := t.b[0]
+	t.b = t.b[1:]
+	return c
+}
+
+func (t *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(t.b)
+	if n <= 0 {
+		t.err = fmt.Errorf("invalid varint")
+		return 0
+	}
+	t.b = t.b[n:]
+	return v
+}
+
+func (t *thriftReader) zigzag() int64 {
+	v := t.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (t *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case 1:
+		return true
+	case 2:
+		return false
+	case 3:
+		return int64(int8(t.byte()))
+	case 4, 5, 6:
+		return t.zigzag()
+	case 7:
+		v := math.Float64frombits(binary.LittleEndian.Uint64(t.b))
+		t.b = t.b[8:]
+		return v
+	case 8:
+		n := int(t.uvarint())
+		if n > len(t.b) {
+			t.err = fmt.Errorf("binary longer than data")
+			return nil
+		}
+		v := t.b[:n]
+		t.b = t.b[n:]
+		return v
+	case 9, 10:
+		h := t.byte()
+		n, elem := int(h>>4), h&0x0f
+		if n == 15 {
+			n = int(t.uvarint())
+		}
+		list := make([]interface{}, n)
+		for i := range list {
+			if elem == 1 || elem == 2 {
+				list[i] = t.byte() == 1
+			} else {
+				list[i] = t.value(elem)
+			}
+		}
+		return list
+	case 12:
+		return t.structure()
+	}
+	t.err = fmt.Errorf("unsupported thrift type %d", typ)
+	return nil
+}
+
+func (t *thriftReader) structure() map[int]interface{} {
+	m := make(map[int]interface{})
+	last := 0
+	for t.err == nil {
+		h := t.byte()
+		if h == 0 {
+			break
+		}
+		id := last + int(h>>4)
+		if h>>4 == 0 {
+			id = int(t.zigzag())
+		}
+		m[id] = t.value(h & 0x0f)
+		last = id
+	}
+	return m
+}
+
+// readParquet reads every row of a Parquet file with optional, flat columns
+// and returns the column names and the rows, with nil for null values.
+func readParquet(t *testing.T, file []byte) ([]string, [][]interface{}) {
+	t.Helper()
+	if !bytes.HasPrefix(file, []byte("PAR1")) || !bytes.HasSuffix(file, []byte("PAR1")) {
+		t.Fatalf("file does not start and end with PAR1")
+	}
+	n := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	tr := &thriftReader{b: file[len(file)-8-n : len(file)-8]}
+	meta := tr.structure()
+	if tr.err != nil {
+		t.Fatalf("invalid file metadata: %v", tr.err)
+	}
+
+	schema := meta[2].([]interface{})
+	if children := schema[0].(map[int]interface{})[5].(int64); int(children) != len(schema)-1 {
+		t.Fatalf("schema root has %d children, want %d", children, len(schema)-1)
+	}
+	var names []string
+	var types []int64
+	for _, e := range schema[1:] {
+		el := e.(map[int]interface{})
+		if rep := el[3].(int64); rep != 1 {
+			t.Fatalf("column %s has repetition %d, want OPTIONAL", el[4], rep)
+		}
+		names = append(names, string(el[4].([]byte)))
+		types = append(types, el[1].(int64))
+	}
+
+	var rows [][]interface{}
+	for _, g := range meta[4].([]interface{}) {
+		group := g.(map[int]interface{})
+		numRows := int(group[3].(int64))
+		groupRows := make([][]interface{}, numRows)
+		for i := range groupRows {
+			groupRows[i] = make([]interface{}, len(names))
+		}
+
+		for c, ch := range group[1].([]interface{}) {
+			md := ch.(map[int]interface{})[3].(map[int]interface{})
+			if codec := md[4].(int64); codec != 0 {
+				t.Fatalf("column %s has codec %d, want UNCOMPRESSED", names[c], codec)
+			}
+			if md[1].(int64) != types[c] {
+				t.Fatalf("column %s has type %d in its chunk and %d in the schema", names[c], md[1], types[c])
+			}
+			if path := md[3].([]interface{}); len(path) != 1 || string(path[0].([]byte)) != names[c] {
+				t.Fatalf("column %s has path %q", names[c], path)
+			}
+
+			off := int(md[9].(int64))
+			pr := &thriftReader{b: file[off:]}
+			header := pr.structure()
+			if pr.err != nil {
+				t.Fatalf("invalid page header: %v", pr.err)
+			}
+			if header[1].(int64) != 0 {
+				t.Fatalf("page type %d, want DATA_PAGE", header[1])
+			}
+			page := pr.b[:header[3].(int64)]
+			dph := header[5].(map[int]interface{})
+			if int(dph[1].(int64)) != numRows {
+				t.Fatalf("page has %d values, want %d", dph[1], numRows)
+			}
+			headerSize := len(file[off:]) - len(pr.b)
+			if size := md[7].(int64); int(size) != headerSize+len(page) {
+				t.Fatalf("chunk size %d, want %d", size, headerSize+len(page))
+			}
+
+			// definition levels: a length, then the RLE and bit-packed
+			// hybrid encoding with a bit width of 1
+			levelsLen := int(binary.LittleEndian.Uint32(page))
+			lr := &thriftReader{b: page[4 : 4+levelsLen]}
+			var defs []byte
+			for len(lr.b) > 0 && lr.err == nil {
+				h := lr.uvarint()
+				if h&1 == 0 {
+					v := lr.byte()
+					for i := 0; i < int(h>>1); i++ {
+						defs = append(defs, v)
+					}
+					continue
+				}
+				for i := 0; i < int(h>>1); i++ {
+					b := lr.byte()
+					for j := 0; j < 8; j++ {
+						defs = append(defs, b>>j&1)
+					}
+				}
+			}
+			if len(defs) < numRows {
+				t.Fatalf("column %s has %d definition levels, want %d", names[c], len(defs), numRows)
+			}
+
+			values := page[4+levelsLen:]
+			bools := 0
+			for i := 0; i < numRows; i++ {
+				if defs[i] == 0 {
+					continue
+				}
+				var v interface{}
+				switch types[c] {
+				case parquetBoolean:
+					v = values[bools/8]>>(bools%8)&1 == 1
+					bools++
+				case parquetInt64:
+					v = int64(binary.LittleEndian.Uint64(values))
+					values = values[8:]
+				case parquetDouble:
+					v = math.Float64frombits(binary.LittleEndian.Uint64(values))
+					values = values[8:]
+				case parquetByteArray:
+					n := binary.LittleEndian.Uint32(values)
+					v = string(values[4 : 4+n])
+					values = values[4+n:]
+				default:
+					t.Fatalf("column %s has unexpected type %d", names[c], types[c])
+				}
+				groupRows[i][c] = v
+			}
+		}
+		rows = append(rows, groupRows...)
+	}
+	if int(meta[3].(int64)) != len(rows) {
+		t.Fatalf("file has %d rows in its metadata and %d in its row groups", meta[3], len(rows))
+	}
+	return names, rows
+}
+
+func TestParquetRoundTrip(t *testing.T) {
+	cols := []ParquetColumn{
+		{"ts", parquetInt64, parquetTimestampMillis},
+		{"name", parquetByteArray, parquetUTF8},
+		{"value", parquetDouble, -1},
+		{"ok", parquetBoolean, -1},
+		{"extra", parquetByteArray, parquetJSON},
+	}
+
+	r := rand.New(rand.NewSource(1))
+	var want [][]interface{}
+	var buf bytes.Buffer
+	pw := NewParquetWriter(&buf, cols, 7)
+	for i := 0; i < 30; i++ {
+		row := make([]interface{}, len(cols))
+		var fields []EventField
+		for c, col := range cols {
+			// leave some values null, including runs of nulls
+			if r.Intn(4) == 0 || i >= 10 && i < 13 {
+				continue
+			}
+			var v interface{}
+			switch col.Type {
+			case parquetInt64:
+				v = r.Int63() - r.Int63()
+			case parquetDouble:
+				v = r.NormFloat64() * 1000
+			case parquetBoolean:
+				v = r.Intn(2) == 0
+			case parquetByteArray:
+				v = randomString(r, r.Intn(20))
+			}
+			row[c] = v
+			fields = append(fields, EventField{col.Name, v})
+		}
+		want = append(want, row)
+		if err := pw.Write(fields); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	names, rows := readParquet(t, buf.Bytes())
+	if len(names) != len(cols) {
+		t.Fatalf("got %d columns, want %d", len(names), len(cols))
+	}
+	for c, col := range cols {
+		if names[c] != col.Name {
+			t.Errorf("column %d is %s, want %s", c, names[c], col.Name)
+		}
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows differ:\ngot  %v\nwant %v", rows, want)
+	}
+}
+
+func TestParquetSchemaColumns(t *testing.T) {
+	s, err := readTestJSONSchema(t, `{
+		"type": "object",
+		"required": ["id", "n"],
+		"properties": {
+			"id": {"type": "integer", "minimum": 0, "maximum": 9},
+			"n": {"type": ["number", "integer"]},
+			"ok": {"type": ["boolean", "null"]},
+			"kind": {"enum": ["a", "b"]},
+			"ts": {"type": "string", "format": "date-time"},
+			"tags": {"type": "array", "items": {"type": "string"}},
+			"any": {"type": ["string", "integer"]}
+		}
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cols, err := ParquetSchemaColumns(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ParquetColumn{
+		{"any", parquetByteArray, parquetJSON},
+		{"id", parquetInt64, -1},
+		{"kind", parquetByteArray, parquetUTF8},
+		{"n", parquetDouble, -1},
+		{"ok", parquetBoolean, -1},
+		{"tags", parquetByteArray, parquetJSON},
+		{"ts", parquetByteArray, parquetUTF8},
+	}
+	if !reflect.DeepEqual(cols, want) {
+		t.Fatalf("got columns %v, want %v", cols, want)
+	}
+
+	// every generated record survives the round trip
+	r := rand.New(rand.NewSource(1))
+	var buf bytes.Buffer
+	pw := NewParquetWriter(&buf, cols, 10)
+	var records [][]EventField
+	for i := 0; i < 25; i++ {
+		fields, err := ParquetRecordFields(nil, cols, s.Append(nil, r))
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, fields)
+		if err := pw.Write(fields); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	names, rows := readParquet(t, buf.Bytes())
+	for i, fields := range records {
+		got := make(map[string]interface{})
+		for c, v := range rows[i] {
+			if v != nil {
+				got[names[c]] = v
+			}
+		}
+		want := make(map[string]interface{})
+		for _, f := range fields {
+			want[f.Name] = f.Value
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("row %d: got %v, want %v", i, got, want)
+		}
+		if _, ok := got["id"].(int64); !ok {
+			t.Errorf("row %d: required integer id is %v", i, got["id"])
+		}
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isClosedPipe returns true if err is the result of writing to a pipe with no
+// reader.
+func isClosedPipe(err error) bool {
+	return errors.Is(err, syscall.EPIPE)
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// ERROR_NO_DATA is returned when writing to a pipe that is being closed
+const errorNoData = syscall.Errno(232)
+
+// isClosedPipe returns true if err is the result of writing to a pipe with no
+// reader.
+func isClosedPipe(err error) bool {
+	return errors.Is(err, syscall.ERROR_BROKEN_PIPE) || errors.Is(err, errorNoData) || errors.Is(err, syscall.EPIPE)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"time"
+)
+
+// maxPlanPeaks is the number of peak steps averaged when the peak of a
+// logistic run is random.
+const maxPlanPeaks = 1000
+
+func planMain(args []string) {
+	flag.CommandLine.Init("plan", flag.ExitOnError)
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: rndout plan [flags]")
+		fmt.Fprintln(flag.CommandLine.Output())
+		fmt.Fprintln(flag.CommandLine.Output(), "Print the expected steps, bytes, lines, peak step output, and average rate")
+		fmt.Fprintln(flag.CommandLine.Output(), "of a run with the same flags, without running it. Without -seed, the peak of")
+		fmt.Fprintln(flag.CommandLine.Output(), "a logistic run is random and the totals are averaged over possible peaks.")
+		fmt.Fprintln(flag.CommandLine.Output(), "Timing effects, like missed steps and -blocked policies, are ignored.")
+		fmt.Fprintln(flag.CommandLine.Output())
+		flag.PrintDefaults()
+	}
+	flag.CommandLine.Parse(args)
+
+	opts.plan = true
+	os.Exit(run())
+}
+
+// A Planner estimates the totals of a run from its rate shape.
+type Planner struct {
+	Steps    int
+	StepSize time.Duration
+
+	// Shapers are the possible shapes of the run, which are equally likely.
+	Shapers      []RateShaper
+	CharsPerStep float64
+
+	// Extra, if not nil, returns the bytes added to a step independently of
+	// the shape, like errors and incident bursts.
+	Extra func(step int) float64
+
+	// SliceLen, Skips, and SkipProb describe skipped steps, like the flags.
+	SliceLen int
+	Skips    int
+	SkipProb float64
+
+	// MaxBurst, if not zero, limits the bytes written in a step. If
+	// DropExcess is true, bytes over the limit are not written later.
+	MaxBurst   int
+	DropExcess bool
+
+	// LineSize is the mean size of a line and Writers is the number of
+	// writers that split each step. If WholeLines is true, lines are never
+	// cut short, so steps write whole lines.
+	LineSize   float64
+	Writers    int
+	WholeLines bool
+}
+
+// Plan is the expected totals of a run.
+type Plan struct {
+	Steps   int
+	Skipped float64
+	Bytes   float64
+	Lines   float64
+
+	// Peak is the largest number of bytes planned for a step.
+	Peak     int
+	StepSize time.Duration
+}
+
+func (p *Planner) Plan() Plan {
+	// a step is skipped if the number of skips in its slice reaches its
+	// position from the end of the slice
+	skipped := make([]float64, p.SliceLen)
+	for i := range skipped {
+		skipped[i] = p.SkipProb * poissonTail(float64(p.Skips), p.SliceLen-i)
+	}
+
+	plan := Plan{Steps: p.Steps, StepSize: p.StepSize}
+	for step := 0; step < p.Steps; step++ {
+		plan.Skipped += skipped[step%p.SliceLen]
+	}
+
+	for _, s := range p.Shapers {
+		for step := 0; step < p.Steps; step++ {
+			nf := p.CharsPerStep * s.Fraction(step)
+			if p.Extra != nil {
+				nf += p.Extra(step)
+			}
+			n, peak := int(nf), int(nf)
+			if p.MaxBurst > 0 && n > p.MaxBurst {
+				if peak = p.MaxBurst; p.DropExcess {
+					n = p.MaxBurst
+				}
+			}
+			if peak > plan.Peak {
+				plan.Peak = peak
+			}
+			if n < 1 {
+				continue
+			}
+
+			// each writer writes whole lines until its share is complete
+			lines := math.Ceil(float64(n)/float64(p.Writers)/p.LineSize) * float64(p.Writers)
+			written := 1 - skipped[step%p.SliceLen]
+			if p.WholeLines {
+				plan.Bytes += written * lines * p.LineSize
+			} else {
+				plan.Bytes += written * float64(n)
+			}
+			plan.Lines += written * lines
+		}
+	}
+	plan.Bytes /= float64(len(p.Shapers))
+	plan.Lines /= float64(len(p.Shapers))
+	return plan
+}
+
+func (p Plan) Report(w io.Writer) {
+	duration := time.Duration(p.Steps) * p.StepSize
+	fmt.Fprintf(w, "steps      %d (%.0f skipped)\n", p.Steps, p.Skipped)
+	fmt.Fprintf(w, "bytes      %.0f\n", p.Bytes)
+	fmt.Fprintf(w, "lines      %.0f\n", p.Lines)
+	fmt.Fprintf(w, "peak step  %d bytes (%.0f bytes/s)\n", p.Peak, float64(p.Peak)/p.StepSize.Seconds())
+	fmt.Fprintf(w, "average    %.0f bytes/s\n", p.Bytes/duration.Seconds())
+}
+
+// LogisticPeaks returns logistic shapers with up to max peak steps spread
+// evenly over a run of the given number of steps.
+func LogisticPeaks(steps, scale, max int) []RateShaper {
+	n := steps
+	if n > max {
+		n = max
+	}
+	shapers := make([]RateShaper, n)
+	for i := range shapers {
+		shapers[i] = LogisticShaper{Mu: i * steps / n, Scale: scale}
+	}
+	return shapers
+}
+
+// MeanLineSize returns the mean size of lines from a source, ending with eol.
+func MeanLineSize(src LineSource, eol string) float64 {
+	const samples = 1000
+
+	r := rand.New(rand.NewSource(1))
+	var total int
+	var line []byte
+	for i := 0; i < samples; i++ {
+		line = src.Line(line[:0], r)
+		total += len(line) + len(eol)
+	}
+	return float64(total) / samples
+}
+
+// poissonTail returns the probability that a Poisson variable with mean l is
+// at least k.
+func poissonTail(l float64, k int) float64 {
+	if l <= 0 {
+		return 0
+	}
+	p := math.Exp(-l)
+	cdf := 0.0
+	for i := 0; i < k; i++ {
+		cdf += p
+		p *= l / float64(i+1)
+	}
+	return math.Max(0, 1-cdf)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+const progressInterval = 250 * time.Millisecond
+
+// Progress shows a single, continuously updated line describing the progress
+// of a run on a terminal.
+type Progress struct {
+	out      io.Writer
+	stats    *Stats
+	start    time.Time
+	duration time.Duration
+}
+
+func NewProgress(out io.Writer, stats *Stats, start time.Time, duration time.Duration) *Progress {
+	return &Progress{
+		out:      out,
+		stats:    stats,
+		start:    start,
+		duration: duration,
+	}
+}
+
+// Run updates the line every interval until done is closed, then shows the
+// final state and ends the line.
+func (p *Progress) Run(interval time.Duration, done <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			p.Draw()
+		case <-done:
+			p.Draw()
+			fmt.Fprintln(p.out)
+			return
+		}
+	}
+}
+
+func (p *Progress) Draw() {
+	elapsed := time.Since(p.start)
+	if elapsed > p.duration {
+		elapsed = p.duration
+	}
+	pct := 100 * float64(elapsed) / float64(p.duration)
+	elapsed = elapsed.Truncate(time.Second)
+	s := p.stats.Snapshot()
+
+	fmt.Fprintf(p.out, "\r%s / %s (%.0f%%), %s remaining, %s written\x1b[K",
+		elapsed,
+		p.duration,
+		pct,
+		p.duration-elapsed,
+		formatBytes(float64(s.Bytes)),
+	)
+}
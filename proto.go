@@ -0,0 +1,69 @@
+package main
+
+import "math"
+
+// The proto functions append protocol buffer encodings of fields to a byte
+// slice. They cover only what the sinks need and avoid depending on the
+// protobuf libraries.
+
+func protoAppendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func protoAppendFixed64(b []byte, v uint64) []byte {
+	for i := 0; i < 8; i++ {
+		b = append(b, byte(v>>(8*i)))
+	}
+	return b
+}
+
+func protoAppendFixed32(b []byte, v uint32) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func protoAppendTag(b []byte, field, wireType int) []byte {
+	return protoAppendVarint(b, uint64(field<<3|wireType))
+}
+
+func protoAppendString(b []byte, field int, s string) []byte {
+	b = protoAppendTag(b, field, 2)
+	b = protoAppendVarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// protoStringSize returns the encoded size of a string field with a field
+// number less than 16.
+func protoStringSize(s string) int {
+	return 1 + protoVarintSize(uint64(len(s))) + len(s)
+}
+
+// protoFieldSize returns the encoded size of a length-delimited field with a
+// field number less than 16 and a payload of size bytes.
+func protoFieldSize(size int) int {
+	return 1 + protoVarintSize(uint64(size)) + size
+}
+
+func protoVarintSize(v uint64) int {
+	n := 1
+	for v >= 0x80 {
+		v >>= 7
+		n++
+	}
+	return n
+}
+
+func protoAppendDouble(b []byte, field int, v float64) []byte {
+	b = protoAppendTag(b, field, 1)
+	return protoAppendFixed64(b, math.Float64bits(v))
+}
+
+// protoAppendMessage appends an encoded message as a length-delimited field.
+func protoAppendMessage(b []byte, field int, msg []byte) []byte {
+	b = protoAppendTag(b, field, 2)
+	b = protoAppendVarint(b, uint64(len(msg)))
+	return append(b, msg...)
+}
@@ -0,0 +1,512 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ProtoMessage is a message type parsed from a .proto file that can generate
+// random messages in the protobuf binary encoding. The parser supports
+// messages, enums, nested types, repeated, optional, map, and oneof fields,
+// and ignores options. Extensions and groups are not supported.
+type ProtoMessage struct {
+	Name   string
+	Fields []*ProtoField
+
+	// oneofs lists the fields in each oneof; one of them is set in each
+	// generated message
+	oneofs [][]*ProtoField
+}
+
+type ProtoField struct {
+	Name     string
+	Number   int
+	Type     string
+	Repeated bool
+
+	message *ProtoMessage
+	enum    []int
+
+	// key and value are set for map fields
+	key, value *ProtoField
+	oneof      bool
+}
+
+// ReadProtoSchema reads a .proto file and returns the named message, or the
+// first message in the file if name is empty.
+func ReadProtoSchema(file, name string) (*ProtoMessage, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	toks, err := protoTokens(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("invalid protobuf schema: %w", err)
+	}
+	p := &protoParser{
+		toks:     toks,
+		messages: make(map[string]*ProtoMessage),
+		enums:    make(map[string][]int),
+	}
+	if err := p.parseFile(); err != nil {
+		return nil, fmt.Errorf("invalid protobuf schema: %w", err)
+	}
+	if err := p.resolve(); err != nil {
+		return nil, fmt.Errorf("invalid protobuf schema: %w", err)
+	}
+
+	if name == "" {
+		if p.first == nil {
+			return nil, errors.New("invalid protobuf schema: no messages")
+		}
+		return p.first, nil
+	}
+	if m, ok := p.messages[strings.TrimPrefix(name, ".")]; ok {
+		return m, nil
+	}
+	return nil, fmt.Errorf("invalid protobuf schema: no message named %q", name)
+}
+
+type protoParser struct {
+	toks []string
+	pos  int
+
+	pkg      string
+	first    *ProtoMessage
+	messages map[string]*ProtoMessage
+	enums    map[string][]int
+	fields   []*ProtoField
+	scopes   []string
+}
+
+// protoTokens splits a .proto file into identifiers, numbers, strings, and
+// symbols, skipping comments.
+func protoTokens(s string) ([]string, error) {
+	var toks []string
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case unicode.IsSpace(rune(c)):
+			i++
+		case strings.HasPrefix(s[i:], "//"):
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(s[i:], "/*"):
+			end := strings.Index(s[i+2:], "*/")
+			if end < 0 {
+				return nil, errors.New("unterminated comment")
+			}
+			i += end + 4
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(s) && s[j] != c {
+				if s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(s) {
+				return nil, errors.New("unterminated string")
+			}
+			toks = append(toks, s[i:j+1])
+			i = j + 1
+		case c == '_' || c == '.' || c == '-' || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)):
+			j := i
+			for j < len(s) && (s[j] == '_' || s[j] == '.' || s[j] == '-' || unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j]))) {
+				j++
+			}
+			toks = append(toks, s[i:j])
+			i = j
+		default:
+			toks = append(toks, s[i:i+1])
+			i++
+		}
+	}
+	return toks, nil
+}
+
+func (p *protoParser) next() string {
+	if p.pos >= len(p.toks) {
+		return ""
+	}
+	p.pos++
+	return p.toks[p.pos-1]
+}
+
+func (p *protoParser) peek() string {
+	if p.pos >= len(p.toks) {
+		return ""
+	}
+	return p.toks[p.pos]
+}
+
+func (p *protoParser) expect(tok string) error {
+	if t := p.next(); t != tok {
+		return fmt.Errorf("expected %q, found %q", tok, t)
+	}
+	return nil
+}
+
+// skipStatement skips to the end of a statement, including any block.
+func (p *protoParser) skipStatement() {
+	depth := 0
+	for t := p.next(); t != ""; t = p.next() {
+		switch t {
+		case "{":
+			depth++
+		case "}":
+			if depth--; depth <= 0 {
+				return
+			}
+		case ";":
+			if depth == 0 {
+				return
+			}
+		}
+	}
+}
+
+func (p *protoParser) parseFile() error {
+	for p.peek() != "" {
+		switch p.next() {
+		case "package":
+			p.pkg = p.next()
+			p.skipStatement()
+		case "message":
+			if _, err := p.parseMessage(); err != nil {
+				return err
+			}
+		case "enum":
+			if err := p.parseEnum(); err != nil {
+				return err
+			}
+		case "extend":
+			return errors.New("extensions are not supported")
+		case ";":
+		default:
+			p.skipStatement()
+		}
+	}
+	return nil
+}
+
+func (p *protoParser) scopedName(name string) string {
+	return strings.Join(append(p.scopes, name), ".")
+}
+
+func (p *protoParser) parseMessage() (*ProtoMessage, error) {
+	m := &ProtoMessage{Name: p.scopedName(p.next())}
+	p.messages[m.Name] = m
+	if p.first == nil {
+		p.first = m
+	}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+
+	p.scopes = append(p.scopes, m.Name[strings.LastIndexByte(m.Name, '.')+1:])
+	defer func() { p.scopes = p.scopes[:len(p.scopes)-1] }()
+
+	for {
+		switch t := p.peek(); t {
+		case "}":
+			p.next()
+			return m, nil
+		case "":
+			return nil, fmt.Errorf("message %s is not closed", m.Name)
+		case "message":
+			p.next()
+			if _, err := p.parseMessage(); err != nil {
+				return nil, err
+			}
+		case "enum":
+			p.next()
+			if err := p.parseEnum(); err != nil {
+				return nil, err
+			}
+		case "oneof":
+			p.next()
+			p.next()
+			if err := p.expect("{"); err != nil {
+				return nil, err
+			}
+			var group []*ProtoField
+			for p.peek() != "}" && p.peek() != "" {
+				if p.peek() == "option" {
+					p.skipStatement()
+					continue
+				}
+				f, err := p.parseField()
+				if err != nil {
+					return nil, err
+				}
+				f.oneof = true
+				m.Fields = append(m.Fields, f)
+				group = append(group, f)
+			}
+			p.next()
+			m.oneofs = append(m.oneofs, group)
+		case "option", "reserved", "extensions":
+			p.skipStatement()
+		case "extend", "group":
+			return nil, fmt.Errorf("%s in message %s is not supported", t, m.Name)
+		case ";":
+			p.next()
+		default:
+			f, err := p.parseField()
+			if err != nil {
+				return nil, err
+			}
+			m.Fields = append(m.Fields, f)
+		}
+	}
+}
+
+func (p *protoParser) parseField() (*ProtoField, error) {
+	f := &ProtoField{}
+	switch p.peek() {
+	case "repeated":
+		f.Repeated = true
+		p.next()
+	case "optional", "required":
+		p.next()
+	}
+
+	f.Type = p.next()
+	if f.Type == "map" {
+		if err := p.expect("<"); err != nil {
+			return nil, err
+		}
+		f.key = &ProtoField{Number: 1, Type: p.scopedType(p.next())}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		f.value = &ProtoField{Number: 2, Type: p.scopedType(p.next())}
+		if err := p.expect(">"); err != nil {
+			return nil, err
+		}
+		f.Repeated = true
+		p.fields = append(p.fields, f.key, f.value)
+	}
+
+	f.Name = p.next()
+	if err := p.expect("="); err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(p.next())
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("field %s has an invalid number", f.Name)
+	}
+	f.Number = n
+	p.skipStatement()
+
+	if f.key == nil {
+		f.Type = p.scopedType(f.Type)
+		p.fields = append(p.fields, f)
+	}
+	return f, nil
+}
+
+// scopedType records the current scope with a type name so that resolve can
+// find the type after the whole file is parsed.
+func (p *protoParser) scopedType(typ string) string {
+	return strings.Join(p.scopes, ".") + "\x00" + typ
+}
+
+func (p *protoParser) parseEnum() error {
+	name := p.scopedName(p.next())
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	var values []int
+	for {
+		switch t := p.next(); t {
+		case "}":
+			if len(values) == 0 {
+				return fmt.Errorf("enum %s has no values", name)
+			}
+			p.enums[name] = values
+			return nil
+		case "":
+			return fmt.Errorf("enum %s is not closed", name)
+		case "option", "reserved":
+			p.skipStatement()
+		case ";":
+		default:
+			if err := p.expect("="); err != nil {
+				return err
+			}
+			v, err := strconv.Atoi(p.next())
+			if err != nil {
+				return fmt.Errorf("enum %s has an invalid value", name)
+			}
+			values = append(values, v)
+			p.skipStatement()
+		}
+	}
+}
+
+// resolve finds the message or enum for each field with a named type,
+// searching from the field's scope outward like protoc.
+func (p *protoParser) resolve() error {
+	for _, f := range p.fields {
+		i := strings.IndexByte(f.Type, 0)
+		scope, typ := f.Type[:i], f.Type[i+1:]
+		f.Type = typ
+		if protoWireType(typ) >= 0 {
+			continue
+		}
+
+		typ = strings.TrimPrefix(strings.TrimPrefix(typ, "."), p.pkg+".")
+		for {
+			name := typ
+			if scope != "" {
+				name = scope + "." + typ
+			}
+			if m, ok := p.messages[name]; ok {
+				f.message = m
+				break
+			}
+			if e, ok := p.enums[name]; ok {
+				f.enum = e
+				break
+			}
+			if scope == "" {
+				return fmt.Errorf("unknown type %q", f.Type)
+			}
+			if i := strings.LastIndexByte(scope, '.'); i >= 0 {
+				scope = scope[:i]
+			} else {
+				scope = ""
+			}
+		}
+	}
+	return nil
+}
+
+// protoWireType returns the wire type of a scalar type, or -1 if the type is
+// not a scalar.
+func protoWireType(typ string) int {
+	switch typ {
+	case "int32", "int64", "uint32", "uint64", "sint32", "sint64", "bool":
+		return 0
+	case "fixed64", "sfixed64", "double":
+		return 1
+	case "string", "bytes":
+		return 2
+	case "fixed32", "sfixed32", "float":
+		return 5
+	}
+	return -1
+}
+
+// Append appends a random message in the protobuf binary encoding. Every
+// field is set except for all but one field in each oneof. Recursive
+// messages stop recursing after a few levels.
+func (m *ProtoMessage) Append(dst []byte, r *rand.Rand) []byte {
+	return m.append(dst, r, 0)
+}
+
+func (m *ProtoMessage) append(dst []byte, r *rand.Rand, depth int) []byte {
+	set := make(map[*ProtoField]bool, len(m.oneofs))
+	for _, group := range m.oneofs {
+		set[group[r.Intn(len(group))]] = true
+	}
+
+	for _, f := range m.Fields {
+		if f.oneof && !set[f] {
+			continue
+		}
+		if f.message != nil && depth > maxGeneratedDepth {
+			continue
+		}
+
+		if !f.Repeated {
+			dst = f.append(dst, r, depth)
+			continue
+		}
+
+		n := r.Intn(5)
+		if depth > maxGeneratedDepth {
+			n = 0
+		}
+		if wt := protoWireType(f.Type); f.key == nil && (wt == 0 || wt == 1 || wt == 5 || f.enum != nil) {
+			// packed encoding
+			var packed []byte
+			for i := 0; i < n; i++ {
+				packed = f.appendValue(packed, r, depth)
+			}
+			if n > 0 {
+				dst = protoAppendMessage(dst, f.Number, packed)
+			}
+			continue
+		}
+		for i := 0; i < n; i++ {
+			dst = f.append(dst, r, depth)
+		}
+	}
+	return dst
+}
+
+// append appends the field's tag and a random value.
+func (f *ProtoField) append(dst []byte, r *rand.Rand, depth int) []byte {
+	switch {
+	case f.key != nil:
+		entry := f.key.append(nil, r, depth)
+		entry = f.value.append(entry, r, depth)
+		return protoAppendMessage(dst, f.Number, entry)
+	case f.message != nil:
+		return protoAppendMessage(dst, f.Number, f.message.append(nil, r, depth+1))
+	case f.enum != nil:
+		dst = protoAppendTag(dst, f.Number, 0)
+	default:
+		dst = protoAppendTag(dst, f.Number, protoWireType(f.Type))
+	}
+	return f.appendValue(dst, r, depth)
+}
+
+// appendValue appends a random scalar or enum value without a tag.
+func (f *ProtoField) appendValue(dst []byte, r *rand.Rand, depth int) []byte {
+	if f.enum != nil {
+		return protoAppendVarint(dst, uint64(int64(f.enum[r.Intn(len(f.enum))])))
+	}
+
+	switch f.Type {
+	case "int32", "int64":
+		return protoAppendVarint(dst, uint64(r.Int63n(2000000)-1000000))
+	case "uint32", "uint64":
+		return protoAppendVarint(dst, uint64(r.Int63n(1000000)))
+	case "sint32", "sint64":
+		return avroAppendLong(dst, r.Int63n(2000000)-1000000)
+	case "bool":
+		return protoAppendVarint(dst, uint64(r.Intn(2)))
+	case "fixed64", "sfixed64":
+		return protoAppendFixed64(dst, r.Uint64())
+	case "double":
+		return protoAppendFixed64(dst, math.Float64bits(r.Float64()*1000))
+	case "fixed32", "sfixed32":
+		return protoAppendFixed32(dst, r.Uint32())
+	case "float":
+		return protoAppendFixed32(dst, math.Float32bits(r.Float32()*1000))
+	case "string":
+		s := randomString(r, 1+r.Intn(32))
+		dst = protoAppendVarint(dst, uint64(len(s)))
+		return append(dst, s...)
+	case "bytes":
+		n := 1 + r.Intn(16)
+		dst = protoAppendVarint(dst, uint64(n))
+		for i := 0; i < n; i++ {
+			dst = append(dst, byte(r.Intn(256)))
+		}
+		return dst
+	}
+	return dst
+}
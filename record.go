@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+var recordHeader = []string{"time", "start", "bytes", "lines"}
+
+func recordMain(args []string) {
+	fs := flag.NewFlagSet("record", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: rndout record [flags] [file]")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Record the rate of a live stream read from a file, stdin, or a TCP connection")
+		fmt.Fprintln(fs.Output(), "as a CSV trace with the bytes and lines received in each interval. The data")
+		fmt.Fprintln(fs.Output(), "itself is not recorded. Replay the trace with 'rndout -mode replay -replay file'.")
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+
+	interval := fs.Duration("interval", 100*time.Millisecond, "length of each recorded interval")
+	output := fs.String("o", "", "write the trace to this file instead of stdout")
+	tee := fs.Bool("tee", false, "copy the stream to stdout; requires -o")
+	listen := fs.String("listen", "", "read from the first TCP connection accepted on this host:port instead of a file")
+	fs.Parse(args)
+
+	if *interval <= 0 {
+		die("invalid interval: must be greater than zero")
+	}
+	if *tee && *output == "" {
+		die("invalid -tee: the trace must be written to a file with -o")
+	}
+
+	in, err := openInput(fs.Arg(0), *listen)
+	if err != nil {
+		die(err)
+	}
+	defer in.Close()
+
+	out := os.Stdout
+	if *output != "" {
+		if out, err = os.Create(*output); err != nil {
+			die(err)
+		}
+		defer out.Close()
+	}
+
+	var copyTo io.Writer
+	if *tee {
+		copyTo = os.Stdout
+	}
+
+	rec := NewRecorder(out)
+	if err := rec.Record(in, copyTo, *interval); err != nil {
+		die(err)
+	}
+}
+
+// Recorder writes a trace of the amount of data received in each interval.
+type Recorder struct {
+	w *csv.Writer
+
+	bytes int64
+	lines int64
+}
+
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: csv.NewWriter(w)}
+}
+
+// Record reads r until EOF, copying the data to copyTo if it is not nil, and
+// writes a trace row at the end of each interval. Intervals start when the
+// first byte is received.
+func (rec *Recorder) Record(r io.Reader, copyTo io.Writer, interval time.Duration) error {
+	if err := rec.w.Write(recordHeader); err != nil {
+		return err
+	}
+
+	first := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- rec.read(r, copyTo, first)
+	}()
+
+	select {
+	case <-first:
+	case err := <-done:
+		return err
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for i := 0; ; i++ {
+		select {
+		case now := <-t.C:
+			if err := rec.row(now, time.Duration(i)*interval); err != nil {
+				return err
+			}
+		case err := <-done:
+			if rerr := rec.row(time.Now(), time.Duration(i)*interval); err == nil {
+				err = rerr
+			}
+			return err
+		}
+	}
+}
+
+func (rec *Recorder) read(r io.Reader, copyTo io.Writer, first chan<- struct{}) error {
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if first != nil {
+				close(first)
+				first = nil
+			}
+			atomic.AddInt64(&rec.bytes, int64(n))
+			atomic.AddInt64(&rec.lines, int64(bytes.Count(buf[:n], []byte{'\n'})))
+			if copyTo != nil {
+				if _, werr := copyTo.Write(buf[:n]); werr != nil {
+					return werr
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// row writes the counts for the interval that ends at t and starts at the
+// given offset from the start of the recording.
+func (rec *Recorder) row(t time.Time, start time.Duration) error {
+	rec.w.Write([]string{
+		t.UTC().Format(time.RFC3339Nano),
+		strconv.FormatFloat(start.Seconds(), 'f', -1, 64),
+		strconv.FormatInt(atomic.SwapInt64(&rec.bytes, 0), 10),
+		strconv.FormatInt(atomic.SwapInt64(&rec.lines, 0), 10),
+	})
+	rec.w.Flush()
+	return rec.w.Error()
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RedisSink adds each line as an entry in a Redis stream with XADD, using
+// the RESP protocol directly. Commands are pipelined: several commands are
+// sent before reading their replies.
+type RedisSink struct {
+	addr     string
+	key      string
+	maxLen   int64
+	pipeline int
+	eol      string
+
+	conn net.Conn
+	br   *bufio.Reader
+	bw   *bufio.Writer
+}
+
+// redisError is an error reply from the server.
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// NewRedisSink creates a sink that adds entries to the stream key on the
+// server at addr. If maxLen is greater than zero, XADD trims the stream to
+// about that many entries.
+func NewRedisSink(addr, key string, maxLen int64, pipeline int, eol string) *RedisSink {
+	return &RedisSink{
+		addr:     addr,
+		key:      key,
+		maxLen:   maxLen,
+		pipeline: pipeline,
+		eol:      eol,
+	}
+}
+
+// Write adds the lines in p to the stream. If a command fails, it returns the
+// number of bytes in the lines that were added before the failure. The
+// connection is opened on the first write and after any network error.
+func (s *RedisSink) Write(p []byte) (int, error) {
+	if s.conn == nil {
+		conn, err := net.DialTimeout("tcp", s.addr, sinkTimeout)
+		if err != nil {
+			return 0, err
+		}
+		s.conn = conn
+		s.br = bufio.NewReader(conn)
+		s.bw = bufio.NewWriter(conn)
+	}
+
+	written := 0
+	lines := strings.Split(strings.TrimSuffix(string(p), s.eol), s.eol)
+	for len(lines) > 0 {
+		n := s.pipeline
+		if n > len(lines) {
+			n = len(lines)
+		}
+
+		s.conn.SetDeadline(time.Now().Add(sinkTimeout))
+		for _, line := range lines[:n] {
+			s.xadd(line)
+		}
+		if err := s.bw.Flush(); err != nil {
+			s.close()
+			return written, err
+		}
+
+		// read every reply to keep the connection in sync, but only count
+		// the lines before the first failure
+		var cmdErr error
+		for _, line := range lines[:n] {
+			err := s.readReply()
+			var rerr redisError
+			if err != nil && !errors.As(err, &rerr) {
+				s.close()
+				return written, err
+			}
+			if err != nil && cmdErr == nil {
+				cmdErr = err
+			}
+			if cmdErr == nil {
+				written += len(line) + len(s.eol)
+			}
+		}
+		if cmdErr != nil {
+			return written, cmdErr
+		}
+		lines = lines[n:]
+	}
+	return len(p), nil
+}
+
+func (s *RedisSink) xadd(line string) {
+	args := []string{"XADD", s.key}
+	if s.maxLen > 0 {
+		args = append(args, "MAXLEN", "~", strconv.FormatInt(s.maxLen, 10))
+	}
+	args = append(args, "*", "line", line)
+
+	fmt.Fprintf(s.bw, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(s.bw, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+}
+
+// readReply reads and discards one reply, returning a redisError if the reply
+// is an error.
+func (s *RedisSink) readReply() error {
+	line, err := s.br.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return errors.New("redis: invalid reply")
+	}
+
+	switch line[0] {
+	case '+', ':':
+		return nil
+	case '-':
+		return redisError(line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return fmt.Errorf("redis: invalid reply: %w", err)
+		}
+		if n < 0 {
+			return nil
+		}
+		_, err = s.br.Discard(n + 2)
+		return err
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return fmt.Errorf("redis: invalid reply: %w", err)
+		}
+		var first error
+		for i := 0; i < n; i++ {
+			if err := s.readReply(); err != nil {
+				var rerr redisError
+				if !errors.As(err, &rerr) {
+					return err
+				}
+				if first == nil {
+					first = err
+				}
+			}
+		}
+		return first
+	}
+	return fmt.Errorf("redis: invalid reply %q", line)
+}
+
+func (s *RedisSink) close() {
+	s.conn.Close()
+	s.conn = nil
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RemoteWriteSink sends each write, which must contain samples in the format
+// generated by PrometheusSource, as a Prometheus remote-write request. The
+// request is a snappy-compressed WriteRequest protobuf message, encoded
+// directly to avoid depending on the protobuf and snappy libraries.
+type RemoteWriteSink struct {
+	url    string
+	header http.Header
+	client *http.Client
+	eol    string
+
+	series map[string]*rwSeries
+	order  []*rwSeries
+	msg    []byte
+	body   []byte
+}
+
+type rwLabel struct {
+	name, value string
+}
+
+type rwSample struct {
+	value     float64
+	timestamp int64
+}
+
+type rwSeries struct {
+	labels  []rwLabel
+	samples []rwSample
+}
+
+// NewRemoteWriteSink creates a sink that posts to url. Headers have the form
+// "Name: value".
+func NewRemoteWriteSink(url string, headers []string, eol string) (*RemoteWriteSink, error) {
+	h := make(http.Header)
+	h.Set("Content-Type", "application/x-protobuf")
+	h.Set("Content-Encoding", "snappy")
+	h.Set("User-Agent", "rndout")
+	h.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if err := addHeaders(h, "remote-write", headers); err != nil {
+		return nil, err
+	}
+
+	return &RemoteWriteSink{
+		url:    url,
+		header: h,
+		client: &http.Client{Timeout: sinkTimeout},
+		eol:    eol,
+		series: make(map[string]*rwSeries),
+	}, nil
+}
+
+// Write sends the samples in p as one request. Samples for a series with the
+// same or an earlier timestamp than the previous sample for that series in
+// the batch are dropped, as receivers reject them.
+func (s *RemoteWriteSink) Write(p []byte) (int, error) {
+	for _, rs := range s.order {
+		rs.samples = rs.samples[:0]
+	}
+	s.order = s.order[:0]
+
+	for _, line := range strings.Split(strings.TrimSuffix(string(p), s.eol), s.eol) {
+		if err := s.add(line); err != nil {
+			return 0, err
+		}
+	}
+
+	s.msg = s.msg[:0]
+	for _, rs := range s.order {
+		s.msg = appendTimeSeries(s.msg, rs)
+	}
+	s.body = snappyEncode(s.body[:0], s.msg)
+
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(s.body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header = s.header.Clone()
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+	res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		err := fmt.Errorf("remote-write returned %s: %s", res.Status, bytes.TrimSpace(msg))
+		if res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500 {
+			return 0, transientError{err}
+		}
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// add parses a sample of the form 'name{label="value",...} value timestamp'
+// and adds it to the batch.
+func (s *RemoteWriteSink) add(line string) error {
+	end := strings.LastIndexByte(line, '}')
+	if end < 0 {
+		return fmt.Errorf("invalid sample %q", line)
+	}
+	fields := strings.Fields(line[end+1:])
+	if len(fields) != 2 {
+		return fmt.Errorf("invalid sample %q", line)
+	}
+
+	key := line[:end+1]
+	rs, ok := s.series[key]
+	if !ok {
+		labels, err := parseSeries(key)
+		if err != nil {
+			return fmt.Errorf("invalid sample %q: %w", line, err)
+		}
+		rs = &rwSeries{labels: labels}
+		s.series[key] = rs
+	}
+
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return fmt.Errorf("invalid sample %q: %w", line, err)
+	}
+	ts, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid sample %q: %w", line, err)
+	}
+
+	if n := len(rs.samples); n > 0 && rs.samples[n-1].timestamp >= ts {
+		return nil
+	}
+	if len(rs.samples) == 0 {
+		s.order = append(s.order, rs)
+	}
+	rs.samples = append(rs.samples, rwSample{value, ts})
+	return nil
+}
+
+// parseSeries parses a series name and labels without escape sequences and
+// returns the labels sorted by name, including the __name__ label.
+func parseSeries(series string) ([]rwLabel, error) {
+	open := strings.IndexByte(series, '{')
+	if open < 1 {
+		return nil, errors.New("missing metric name")
+	}
+	labels := []rwLabel{{"__name__", series[:open]}}
+
+	rest := series[open+1 : len(series)-1]
+	for rest != "" {
+		name, after, ok := strings.Cut(rest, `="`)
+		if !ok {
+			return nil, errors.New("invalid label")
+		}
+		value, after, ok := strings.Cut(after, `"`)
+		if !ok {
+			return nil, errors.New("unterminated label value")
+		}
+		labels = append(labels, rwLabel{name, value})
+		rest = strings.TrimPrefix(after, ",")
+	}
+
+	sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+	return labels, nil
+}
+
+// appendTimeSeries appends a TimeSeries as field 1 of a WriteRequest.
+//
+//	message TimeSeries { repeated Label labels = 1; repeated Sample samples = 2; }
+//	message Label { string name = 1; string value = 2; }
+//	message Sample { double value = 1; int64 timestamp = 2; }
+func appendTimeSeries(b []byte, rs *rwSeries) []byte {
+	size := 0
+	for _, l := range rs.labels {
+		size += protoFieldSize(protoStringSize(l.name) + protoStringSize(l.value))
+	}
+	for _, s := range rs.samples {
+		size += protoFieldSize(9 + 1 + protoVarintSize(uint64(s.timestamp)))
+	}
+
+	b = protoAppendTag(b, 1, 2)
+	b = protoAppendVarint(b, uint64(size))
+	for _, l := range rs.labels {
+		b = protoAppendTag(b, 1, 2)
+		b = protoAppendVarint(b, uint64(protoStringSize(l.name)+protoStringSize(l.value)))
+		b = protoAppendString(b, 1, l.name)
+		b = protoAppendString(b, 2, l.value)
+	}
+	for _, s := range rs.samples {
+		b = protoAppendTag(b, 2, 2)
+		b = protoAppendVarint(b, uint64(9+1+protoVarintSize(uint64(s.timestamp))))
+		b = protoAppendDouble(b, 1, s.value)
+		b = protoAppendTag(b, 2, 0)
+		b = protoAppendVarint(b, uint64(s.timestamp))
+	}
+	return b
+}
+
+// snappyEncode appends the snappy block encoding of src to dst. It only emits
+// literals, so the output is slightly larger than the input, but any snappy
+// decoder accepts it.
+func snappyEncode(dst, src []byte) []byte {
+	dst = protoAppendVarint(dst, uint64(len(src)))
+	for len(src) > 0 {
+		n := len(src)
+		if n > 1<<16 {
+			n = 1 << 16
+		}
+		switch {
+		case n <= 60:
+			dst = append(dst, byte(n-1)<<2)
+		case n <= 1<<8:
+			dst = append(dst, 60<<2, byte(n-1))
+		default:
+			dst = append(dst, 61<<2, byte(n-1), byte((n-1)>>8))
+		}
+		dst = append(dst, src[:n]...)
+		src = src[n:]
+	}
+	return dst
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// RetryWriter retries writes that fail with transient errors, waiting with
+// exponential backoff between attempts. Bytes that are retried or abandoned
+// after the last attempt are recorded in Stats.
+type RetryWriter struct {
+	W          io.Writer
+	Stats      *Stats
+	Retries    int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+func (w RetryWriter) Write(p []byte) (written int, err error) {
+	backoff := w.Backoff
+	for attempt := 0; ; attempt++ {
+		var n int
+		n, err = w.W.Write(p[written:])
+		written += n
+		if err == nil || !isTransient(err) {
+			return written, err
+		}
+
+		remaining := int64(len(p) - written)
+		if attempt >= w.Retries {
+			atomic.AddInt64(&w.Stats.AbandonedBytes, remaining)
+			return written, err
+		}
+		atomic.AddInt64(&w.Stats.RetriedBytes, remaining)
+
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > w.MaxBackoff {
+			backoff = w.MaxBackoff
+		}
+	}
+}
+
+// transientError marks an error from a sink that may succeed if the write is
+// retried, such as an overloaded server.
+type transientError struct {
+	error
+}
+
+func (e transientError) Unwrap() error {
+	return e.error
+}
+
+// isTransient returns true if err is a temporary condition that may succeed
+// if the operation is retried.
+func isTransient(err error) bool {
+	var nerr net.Error
+	if errors.As(err, &nerr) && nerr.Timeout() {
+		return true
+	}
+	var terr transientError
+	if errors.As(err, &terr) {
+		return true
+	}
+	return errors.Is(err, syscall.EAGAIN) ||
+		errors.Is(err, syscall.EINTR) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ETIMEDOUT)
+}
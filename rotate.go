@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+func rotateMain(args []string) {
+	fs := flag.NewFlagSet("rotate", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: rndout rotate [flags] dir")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Write a set of log files to dir as if a log had already been rotated several")
+		fmt.Fprintln(fs.Output(), "times: the active file, app.log, and older files app.log.1, app.log.2.gz, and")
+		fmt.Fprintln(fs.Output(), "so on. Files are written as fast as possible. The lines in each file have")
+		fmt.Fprintln(fs.Output(), "timestamps spread evenly over the file's share of the time span, and each")
+		fmt.Fprintln(fs.Output(), "file's modification time is the time of its last line.")
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+
+	name := fs.String("name", "app.log", "name of the active log file")
+	files := fs.Int("files", 5, "number of files, including the active file")
+	size := fs.String("size", "1m", "mean size of each file before compression")
+	sizeDist := fs.String("size-dist", SizeDistFixed, "distribution of file sizes, one of 'fixed', 'uniform', or 'exponential'")
+	compress := fs.Int("compress", 2, "gzip rotated files with this number or higher; if 0, do not compress files")
+	span := fs.Duration("span", 24*time.Hour, "length of time covered by all of the files")
+	endTime := fs.String("end", "", "time of the last line, in RFC 3339 format; if empty, use the current time")
+	timestamp := fs.String("timestamp", "rfc3339", "start each line with a timestamp in this format: 'rfc3339', 'rfc3339nano', 'unix', 'unixms', or a Go time layout; not used with journal, avro, or protobuf content unless set")
+	blockSize := fs.Int("block-size", 256, "number of characters in each line, including the line ending")
+	sequence := fs.Bool("sequence", false, "start each line with a sequence number that continues from the oldest file to the active file")
+	crlf := fs.Bool("crlf", false, "end lines with CRLF instead of LF")
+	textStyle := fs.String("text", TextUniform, "the random text in lines and messages, one of 'uniform' characters or 'english' word-like text")
+	var content contentOptions
+	content.addFlags(fs)
+	seed := fs.Int64("seed", 0, "seed for all random decisions; if 0, use the current time")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *files < 1 {
+		die("invalid files: must be at least 1")
+	}
+	mean, err := parseScaled("size", *size)
+	if err != nil {
+		die(err)
+	}
+	if mean < 0 {
+		die("invalid size: must not be negative")
+	}
+	switch *sizeDist {
+	case SizeDistFixed, SizeDistUniform, SizeDistExponential:
+	default:
+		die("invalid size distribution: must be one of 'fixed', 'uniform', or 'exponential'")
+	}
+	if *compress < 0 {
+		die("invalid compress: must not be negative")
+	}
+	if *span < 0 {
+		die("invalid span: must not be negative")
+	}
+	end := time.Now()
+	if *endTime != "" {
+		if end, err = time.Parse(time.RFC3339Nano, *endTime); err != nil {
+			die(fmt.Errorf("invalid end: %w", err))
+		}
+	}
+
+	if content.content == ContentJournal || content.binary() {
+		// the default timestamp only applies to lines of text
+		set := false
+		fs.Visit(func(f *flag.Flag) {
+			set = set || f.Name == "timestamp"
+		})
+		if *sequence || set && *timestamp != "" {
+			die("invalid content: journal entries and binary records can't have -sequence or -timestamp")
+		}
+		*timestamp = ""
+	}
+	eol := content.lineEnding(*crlf)
+	if *blockSize < len(eol)+1 {
+		die(fmt.Sprintf("invalid block size: must be at least %d", len(eol)+1))
+	}
+
+	text := NewTextFunc(*textStyle)
+	if text == nil {
+		die("invalid text: must be one of 'uniform' or 'english'")
+	}
+	rot := &Rotation{
+		Dir:       fs.Arg(0),
+		Name:      *name,
+		Files:     *files,
+		Compress:  *compress,
+		Start:     end.Add(-*span),
+		End:       end,
+		Timestamp: *timestamp,
+		LineSize:  float64(*blockSize),
+	}
+
+	// timestamps in the content match the timestamps of the lines
+	events, err := ParseEventMix(content.events)
+	if err != nil {
+		die(err)
+	}
+	source, err := content.newSource(eol, *blockSize, text, events, rot.Now)
+	if err != nil {
+		die(err)
+	}
+
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	r := rand.New(rand.NewSource(*seed))
+
+	out := NewRandomOutput(r, 32, *blockSize, eol, text)
+	out.Source = source
+	if *sequence {
+		out.Decorators = append(out.Decorators, SequenceDecorator())
+	}
+
+	if source != nil {
+		// generated lines are written in full, after their timestamps
+		rot.LineSize = MeanLineSize(source, eol)
+		if *timestamp != "" {
+			ts, _ := TimestampDecorator(func() time.Time { return end }, *timestamp)(nil, nil)
+			rot.LineSize += float64(len(ts))
+		}
+	}
+	if err := rot.Write(out, func() int64 { return randomAmount(r, mean, *sizeDist) }); err != nil {
+		die(err)
+	}
+}
+
+// Rotation describes a set of rotated log files.
+type Rotation struct {
+	Dir  string
+	Name string
+
+	// Files is the number of files, including the active file.
+	Files int
+
+	// Compress is the number of the first rotated file that is compressed. If
+	// zero, no files are compressed.
+	Compress int
+
+	// Start and End are the times of the first line of the oldest file and
+	// the last line of the active file.
+	Start time.Time
+	End   time.Time
+
+	// Timestamp is the format of line timestamps. If empty, lines do not have
+	// timestamps.
+	Timestamp string
+
+	// LineSize is the mean size of a line, which spreads the timestamps of
+	// each file over its share of the time span.
+	LineSize float64
+
+	line, next, fileEnd time.Time
+	lineStep            time.Duration
+}
+
+// Now returns the time of the line being written, or Start before the first
+// line.
+func (rot *Rotation) Now() time.Time {
+	if rot.line.IsZero() {
+		return rot.Start
+	}
+	return rot.line
+}
+
+// FileName returns the name of the file with the given number, where 0 is the
+// active file.
+func (rot *Rotation) FileName(i int) string {
+	name := rot.Name
+	if i > 0 {
+		name += "." + strconv.Itoa(i)
+	}
+	if rot.Compress > 0 && i >= rot.Compress {
+		name += ".gz"
+	}
+	return filepath.Join(rot.Dir, name)
+}
+
+// Write writes the files from oldest to newest, filling each with lines from
+// out. The size function returns the uncompressed size of the next file.
+func (rot *Rotation) Write(out *RandomOutput, size func() int64) error {
+	if err := os.MkdirAll(rot.Dir, 0755); err != nil {
+		return err
+	}
+
+	// each file covers an equal share of the span; a line's time is set
+	// from its position in the file, before its decorations and content, and
+	// never passes the end of the file's share if the file has more lines
+	// than expected
+	out.Decorators = append(out.Decorators, func(prefix, suffix []byte) ([]byte, []byte) {
+		rot.line = rot.next
+		if rot.next = rot.next.Add(rot.lineStep); rot.next.After(rot.fileEnd) {
+			rot.next = rot.fileEnd
+		}
+		return prefix, suffix
+	})
+	if rot.Timestamp != "" {
+		out.Decorators = append(out.Decorators, TimestampDecorator(rot.Now, rot.Timestamp))
+	}
+
+	fileSpan := rot.End.Sub(rot.Start) / time.Duration(rot.Files)
+	for i := rot.Files - 1; i >= 0; i-- {
+		n := size()
+
+		rot.next = rot.Start.Add(time.Duration(rot.Files-1-i) * fileSpan)
+		rot.line = rot.next
+		rot.fileEnd = rot.next.Add(fileSpan)
+		rot.lineStep = 0
+		if lines := int64(float64(n) / rot.LineSize); lines > 1 {
+			rot.lineStep = fileSpan / time.Duration(lines-1)
+		}
+
+		name := rot.FileName(i)
+		if err := rot.writeFile(name, out, n, rot.Compress > 0 && i >= rot.Compress); err != nil {
+			return err
+		}
+
+		// the file was last modified at the time of its last line
+		if err := os.Chtimes(name, rot.line, rot.line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rot *Rotation) writeFile(name string, out *RandomOutput, n int64, compress bool) (err error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	bw := bufio.NewWriterSize(f, 64*1024)
+	var w io.Writer = bw
+
+	var zw *gzip.Writer
+	if compress {
+		zw = gzip.NewWriter(bw)
+		w = zw
+	}
+
+	if _, err := out.WriteN(w, int(n)); err != nil {
+		return err
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
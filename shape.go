@@ -0,0 +1,204 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// shapeOptions configure the shape of the output rate. They are shared by
+// the commands that shape output.
+type shapeOptions struct {
+	peakRate string
+	mode     string
+	duration time.Duration
+	stepSize time.Duration
+
+	// logistic flags
+	scale int
+
+	// ramp flags
+	rampDuration time.Duration
+
+	// seasonal flags
+	trendStart float64
+	trendEnd   float64
+	seasons    listFlag
+	noise      float64
+
+	// replay flags
+	replay      string
+	replayScale float64
+}
+
+func (o *shapeOptions) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.peakRate, "rate", "128", "peak character rate in chars/s")
+	fs.StringVar(&o.mode, "mode", LogisticMode, "the operation mode, one of 'logistic', 'ramp', 'seasonal', or 'replay'")
+	fs.DurationVar(&o.duration, "duration", 60*time.Second, "duration")
+	fs.DurationVar(&o.stepSize, "step-size", 250*time.Millisecond, "length of each time step")
+
+	// logistic flags
+	fs.IntVar(&o.scale, "scale", 25, "scale factor for the output distribution; only used with -mode=logistic")
+
+	// ramp flags
+	fs.DurationVar(&o.rampDuration, "ramp-duration", 10*time.Second, "time taken to reach the peak rate; only used with -mode=ramp")
+
+	// seasonal flags
+	fs.Float64Var(&o.trendStart, "trend-start", 0.5, "trend at the start of the run, as a fraction of the peak rate; only used with -mode=seasonal")
+	fs.Float64Var(&o.trendEnd, "trend-end", 0.5, "trend at the end of the run, as a fraction of the peak rate; only used with -mode=seasonal")
+	fs.Var(&o.seasons, "season", "seasonal component added to the trend, as 'period:amplitude[:peak]' (e.g. '24h:0.2:14h'), where the amplitude is a fraction of the peak rate and the component peaks at the peak time and every period after it; may be repeated; only used with -mode=seasonal")
+	fs.Float64Var(&o.noise, "noise", 0, "standard deviation of random noise added to each step, as a fraction of the peak rate; only used with -mode=seasonal")
+
+	// replay flags
+	fs.StringVar(&o.replay, "replay", "", "trace to replay, from 'rndout record', 'rndout verify', or -trace-file; -rate is not used; only used with -mode=replay")
+	fs.Float64Var(&o.replayScale, "replay-scale", 1, "multiple of the recorded rate to replay at; only used with -mode=replay")
+}
+
+// newShaper validates the options and returns the shaper and the number of
+// characters to write in each step at the peak rate.
+func (o *shapeOptions) newShaper(r *rand.Rand) (RateShaper, float64, error) {
+	rate, err := parseRate(o.peakRate)
+	if err != nil {
+		return nil, 0, err
+	}
+	if o.stepSize <= 0 || o.stepSize > o.duration {
+		return nil, 0, errors.New("invalid step size: must be less than duration")
+	}
+	charsPerStep := float64(rate) * o.stepSize.Seconds()
+
+	switch o.mode {
+	case LogisticMode:
+		peakStep := r.Intn(int(o.duration / o.stepSize))
+		return LogisticShaper{Mu: peakStep, Scale: o.scale}, charsPerStep, nil
+
+	case RampMode:
+		peakStep := int(o.rampDuration / o.stepSize)
+		return RampShaper{PeakStep: peakStep}, charsPerStep, nil
+
+	case SeasonalMode:
+		s := &SeasonalShaper{
+			Steps:      int(o.duration / o.stepSize),
+			StepSize:   o.stepSize,
+			TrendStart: o.trendStart,
+			TrendEnd:   o.trendEnd,
+		}
+		for _, v := range o.seasons {
+			season, err := parseSeason(v)
+			if err != nil {
+				return nil, 0, err
+			}
+			s.Seasons = append(s.Seasons, season)
+		}
+		if o.noise < 0 {
+			return nil, 0, errors.New("invalid noise: must not be negative")
+		}
+		if o.noise > 0 {
+			// the noise has its own source so that it does not depend on
+			// the number of steps
+			nr := rand.New(rand.NewSource(r.Int63()))
+			s.Noise = make([]float64, s.Steps)
+			for i := range s.Noise {
+				s.Noise[i] = o.noise * nr.NormFloat64()
+			}
+		}
+		return s, charsPerStep, nil
+
+	case ReplayMode:
+		if o.replay == "" {
+			return nil, 0, errors.New("invalid replay: a trace is required with -mode=replay")
+		}
+		if o.replayScale <= 0 {
+			return nil, 0, errors.New("invalid replay scale: must be greater than zero")
+		}
+		profile, err := readProfileFile(o.replay, o.stepSize)
+		if err != nil {
+			return nil, 0, err
+		}
+		var peak int64
+		for _, n := range profile {
+			if n > peak {
+				peak = n
+			}
+		}
+		if peak == 0 {
+			return nil, 0, fmt.Errorf("invalid replay: %s has no data", o.replay)
+		}
+		s := ReplayShaper{Fractions: make([]float64, len(profile))}
+		for i, n := range profile {
+			s.Fractions[i] = float64(n) / float64(peak)
+		}
+		return s, float64(peak) * o.replayScale, nil
+
+	default:
+		return nil, 0, errors.New("invalid mode: must be one of 'logistic', 'ramp', 'seasonal', or 'replay'")
+	}
+}
+
+// A Season is a periodic component of a seasonal rate. It peaks at Peak and
+// every Period after it, adding Amplitude to the rate, and adds -Amplitude
+// halfway between peaks.
+type Season struct {
+	Period    time.Duration
+	Amplitude float64
+	Peak      time.Duration
+}
+
+// parseSeason parses a season in the form 'period:amplitude[:peak]'.
+func parseSeason(v string) (Season, error) {
+	var s Season
+	parts := strings.Split(v, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return s, fmt.Errorf("invalid season %q: must be period:amplitude[:peak]", v)
+	}
+
+	var err error
+	if s.Period, err = time.ParseDuration(parts[0]); err != nil || s.Period <= 0 {
+		return s, fmt.Errorf("invalid season %q: period must be a positive duration", v)
+	}
+	if s.Amplitude, err = strconv.ParseFloat(parts[1], 64); err != nil {
+		return s, fmt.Errorf("invalid season %q: %w", v, err)
+	}
+	if len(parts) == 3 {
+		if s.Peak, err = time.ParseDuration(parts[2]); err != nil {
+			return s, fmt.Errorf("invalid season %q: %w", v, err)
+		}
+	}
+	return s, nil
+}
+
+// SeasonalShaper shapes output as the sum of a linear trend, seasonal
+// components, and noise, limited to [0.0, 1.0].
+type SeasonalShaper struct {
+	Steps    int
+	StepSize time.Duration
+
+	// TrendStart and TrendEnd are the trend at the first step and after the
+	// last step.
+	TrendStart float64
+	TrendEnd   float64
+
+	Seasons []Season
+
+	// Noise, if not nil, is the noise added to each step. Steps after the
+	// last noise value have no noise.
+	Noise []float64
+}
+
+func (s *SeasonalShaper) Fraction(step int) float64 {
+	f := s.TrendStart + (s.TrendEnd-s.TrendStart)*float64(step)/float64(s.Steps)
+
+	t := time.Duration(step) * s.StepSize
+	for _, season := range s.Seasons {
+		phase := float64(t-season.Peak) / float64(season.Period)
+		f += season.Amplitude * math.Cos(2*math.Pi*phase)
+	}
+	if step < len(s.Noise) {
+		f += s.Noise[step]
+	}
+	return math.Max(0, math.Min(1, f))
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/binary"
+	"strconv"
+	"time"
+)
+
+// OTLP span kinds for generated spans.
+const (
+	otlpSpanKindInternal = 1
+	otlpSpanKindServer   = 2
+)
+
+// SpanTree generates spans that form complete trace trees. Each trace has a
+// root span, and each span above the maximum depth has Fanout children. Spans
+// are generated in depth-first order, so a trace may continue across several
+// batches. Children divide their parent's duration equally and run one after
+// another.
+type SpanTree struct {
+	Depth    int
+	Fanout   int
+	Duration time.Duration
+
+	run   uint64
+	trace uint64
+	span  uint64
+	stack []spanFrame
+}
+
+type spanFrame struct {
+	id       uint64
+	start    time.Time
+	duration time.Duration
+	children int
+}
+
+// NewSpanTree creates a span generator. The trace IDs include the start time
+// of the run so that IDs from different runs do not collide.
+func NewSpanTree(depth, fanout int, duration time.Duration) *SpanTree {
+	return &SpanTree{
+		Depth:    depth,
+		Fanout:   fanout,
+		Duration: duration,
+		run:      uint64(time.Now().UnixNano()),
+	}
+}
+
+// next returns the next span in the current trace and its parent, or starts a
+// new trace at now and returns its root span with a nil parent.
+func (t *SpanTree) next(now time.Time) (span, parent *spanFrame) {
+	for n := len(t.stack); n > 0 && (n >= t.Depth || t.stack[n-1].children >= t.Fanout); n-- {
+		t.stack = t.stack[:n-1]
+	}
+
+	t.span++
+	if len(t.stack) == 0 {
+		t.trace++
+		t.stack = append(t.stack, spanFrame{id: t.span, start: now, duration: t.Duration})
+		return &t.stack[0], nil
+	}
+
+	p := &t.stack[len(t.stack)-1]
+	d := p.duration / time.Duration(t.Fanout)
+	start := p.start.Add(time.Duration(p.children) * d)
+	p.children++
+
+	t.stack = append(t.stack, spanFrame{id: t.span, start: start, duration: d})
+	n := len(t.stack)
+	return &t.stack[n-1], &t.stack[n-2]
+}
+
+// appendSpan appends the next span, with line as an attribute.
+//
+//	message Span {
+//	  bytes trace_id = 1; bytes span_id = 2; bytes parent_span_id = 4;
+//	  string name = 5; SpanKind kind = 6; fixed64 start_time_unix_nano = 7;
+//	  fixed64 end_time_unix_nano = 8; repeated KeyValue attributes = 9;
+//	}
+func (t *SpanTree) appendSpan(b []byte, line string, now time.Time) []byte {
+	span, parent := t.next(now)
+
+	var traceID [16]byte
+	binary.BigEndian.PutUint64(traceID[:8], t.run)
+	binary.BigEndian.PutUint64(traceID[8:], t.trace)
+	var spanID [8]byte
+	binary.BigEndian.PutUint64(spanID[:], span.id)
+
+	b = protoAppendMessage(b, 1, traceID[:])
+	b = protoAppendMessage(b, 2, spanID[:])
+	kind := otlpSpanKindServer
+	name := "request"
+	if parent != nil {
+		var parentID [8]byte
+		binary.BigEndian.PutUint64(parentID[:], parent.id)
+		b = protoAppendMessage(b, 4, parentID[:])
+		kind = otlpSpanKindInternal
+		name = "operation-" + strconv.Itoa(len(t.stack)-1) + "." + strconv.Itoa(parent.children)
+	}
+	b = protoAppendString(b, 5, name)
+	b = protoAppendTag(b, 6, 0)
+	b = protoAppendVarint(b, uint64(kind))
+	b = protoAppendTag(b, 7, 1)
+	b = protoAppendFixed64(b, uint64(span.start.UnixNano()))
+	b = protoAppendTag(b, 8, 1)
+	b = protoAppendFixed64(b, uint64(span.start.Add(span.duration).UnixNano()))
+	return otlpAppendAttribute(b, 9, "line", line)
+}
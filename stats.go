@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Stats records metrics about a run. Fields are updated atomically so that
+// reporters may read them while output is being generated; use Snapshot to
+// get a consistent copy.
+type Stats struct {
+	Steps        int64 `json:"steps"`
+	SkippedSteps int64 `json:"skipped_steps"`
+	PausedSteps  int64 `json:"paused_steps"`
+	MissedSteps  int64 `json:"missed_steps"`
+	PlannedBytes int64 `json:"planned_bytes"`
+	Bytes        int64 `json:"bytes"`
+	Writes       int64 `json:"writes"`
+	Errors       int64 `json:"errors"`
+
+	RetriedBytes   int64 `json:"retried_bytes"`
+	AbandonedBytes int64 `json:"abandoned_bytes"`
+	DroppedBytes   int64 `json:"dropped_bytes"`
+	CatchUpBytes   int64 `json:"catch_up_bytes"`
+}
+
+func (s *Stats) Snapshot() Stats {
+	return Stats{
+		Steps:        atomic.LoadInt64(&s.Steps),
+		SkippedSteps: atomic.LoadInt64(&s.SkippedSteps),
+		PausedSteps:  atomic.LoadInt64(&s.PausedSteps),
+		MissedSteps:  atomic.LoadInt64(&s.MissedSteps),
+		PlannedBytes: atomic.LoadInt64(&s.PlannedBytes),
+		Bytes:        atomic.LoadInt64(&s.Bytes),
+		Writes:       atomic.LoadInt64(&s.Writes),
+		Errors:       atomic.LoadInt64(&s.Errors),
+
+		RetriedBytes:   atomic.LoadInt64(&s.RetriedBytes),
+		AbandonedBytes: atomic.LoadInt64(&s.AbandonedBytes),
+		DroppedBytes:   atomic.LoadInt64(&s.DroppedBytes),
+		CatchUpBytes:   atomic.LoadInt64(&s.CatchUpBytes),
+	}
+}
+
+// Sub returns the difference between two snapshots.
+func (s Stats) Sub(prev Stats) Stats {
+	return Stats{
+		Steps:        s.Steps - prev.Steps,
+		SkippedSteps: s.SkippedSteps - prev.SkippedSteps,
+		PausedSteps:  s.PausedSteps - prev.PausedSteps,
+		MissedSteps:  s.MissedSteps - prev.MissedSteps,
+		PlannedBytes: s.PlannedBytes - prev.PlannedBytes,
+		Bytes:        s.Bytes - prev.Bytes,
+		Writes:       s.Writes - prev.Writes,
+		Errors:       s.Errors - prev.Errors,
+
+		RetriedBytes:   s.RetriedBytes - prev.RetriedBytes,
+		AbandonedBytes: s.AbandonedBytes - prev.AbandonedBytes,
+		DroppedBytes:   s.DroppedBytes - prev.DroppedBytes,
+		CatchUpBytes:   s.CatchUpBytes - prev.CatchUpBytes,
+	}
+}
+
+// Summary describes the totals for a run.
+func (s Stats) Summary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d bytes in %d writes (%d planned), %d of %d steps skipped, %d errors",
+		s.Bytes, s.Writes, s.PlannedBytes, s.SkippedSteps, s.Steps, s.Errors)
+
+	extra := []struct {
+		n    int64
+		desc string
+	}{
+		{s.PausedSteps, "steps paused"},
+		{s.MissedSteps, "steps missed"},
+		{s.RetriedBytes, "bytes retried"},
+		{s.AbandonedBytes, "bytes abandoned"},
+		{s.DroppedBytes, "bytes dropped"},
+		{s.CatchUpBytes, "bytes caught up"},
+	}
+	for _, e := range extra {
+		if e.n > 0 {
+			fmt.Fprintf(&b, ", %d %s", e.n, e.desc)
+		}
+	}
+	return b.String()
+}
+
+// StatsWriter is an io.Writer that records the writes it forwards in Stats.
+type StatsWriter struct {
+	W     io.Writer
+	Stats *Stats
+}
+
+func (w StatsWriter) Write(p []byte) (int, error) {
+	n, err := w.W.Write(p)
+	atomic.AddInt64(&w.Stats.Bytes, int64(n))
+	atomic.AddInt64(&w.Stats.Writes, 1)
+	if err != nil {
+		atomic.AddInt64(&w.Stats.Errors, 1)
+	}
+	return n, err
+}
+
+// StatsRecord is a single entry in a stats stream. Counts are cumulative for
+// the run; Rate is the achieved output rate since the previous record.
+type StatsRecord struct {
+	Time    time.Time `json:"time"`
+	Elapsed float64   `json:"elapsed"`
+	Stats
+	Rate float64 `json:"rate"`
+}
+
+// StatsStream writes newline-delimited JSON stats records.
+type StatsStream struct {
+	enc   *json.Encoder
+	stats *Stats
+	start time.Time
+	last  StatsRecord
+}
+
+func NewStatsStream(w io.Writer, stats *Stats, start time.Time) *StatsStream {
+	return &StatsStream{
+		enc:   json.NewEncoder(w),
+		stats: stats,
+		start: start,
+		last:  StatsRecord{Time: start},
+	}
+}
+
+// Run writes a record every interval until done is closed, then writes a
+// final record.
+func (s *StatsStream) Run(interval time.Duration, done <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			s.Record()
+		case <-done:
+			s.Record()
+			return
+		}
+	}
+}
+
+func (s *StatsStream) Record() {
+	now := time.Now()
+	rec := StatsRecord{
+		Time:    now,
+		Elapsed: now.Sub(s.start).Seconds(),
+		Stats:   s.stats.Snapshot(),
+	}
+	if d := now.Sub(s.last.Time).Seconds(); d > 0 {
+		rec.Rate = float64(rec.Bytes-s.last.Bytes) / d
+	}
+
+	// errors are ignored: stats are best-effort and must not stop the run
+	_ = s.enc.Encode(rec)
+	s.last = rec
+}
+
+// formatBytes formats a byte count using decimal units, matching the suffixes
+// accepted by -rate.
+func formatBytes(n float64) string {
+	const units = "KMG"
+	if n < 1000 {
+		return fmt.Sprintf("%.0f B", n)
+	}
+	u := -1
+	for n >= 1000 && u < len(units)-1 {
+		n /= 1000
+		u++
+	}
+	return fmt.Sprintf("%.1f %cB", n, units[u])
+}
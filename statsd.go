@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// StatsdEmitter periodically sends run metrics to a statsd server. If tags
+// are set, metrics use the DogStatsD tag extension.
+type StatsdEmitter struct {
+	conn   net.Conn
+	prefix string
+	tags   string
+	stats  *Stats
+	last   Stats
+	lastT  time.Time
+}
+
+func NewStatsdEmitter(addr, prefix string, tags []string, stats *Stats) (*StatsdEmitter, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid statsd address: %w", err)
+	}
+
+	if prefix != "" && !strings.HasSuffix(prefix, ".") {
+		prefix += "."
+	}
+
+	var t string
+	if len(tags) > 0 {
+		t = "|#" + strings.Join(tags, ",")
+	}
+
+	return &StatsdEmitter{
+		conn:   conn,
+		prefix: prefix,
+		tags:   t,
+		stats:  stats,
+		lastT:  time.Now(),
+	}, nil
+}
+
+// Run emits metrics every interval until done is closed, then emits the final
+// values and closes the connection.
+func (e *StatsdEmitter) Run(interval time.Duration, done <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			e.Emit()
+		case <-done:
+			e.Emit()
+			e.conn.Close()
+			return
+		}
+	}
+}
+
+func (e *StatsdEmitter) Emit() {
+	now := time.Now()
+	s := e.stats.Snapshot()
+	d := s.Sub(e.last)
+	elapsed := now.Sub(e.lastT).Seconds()
+
+	var b bytes.Buffer
+	e.metric(&b, "steps", d.Steps, "c")
+	e.metric(&b, "skipped_steps", d.SkippedSteps, "c")
+	e.metric(&b, "paused_steps", d.PausedSteps, "c")
+	e.metric(&b, "missed_steps", d.MissedSteps, "c")
+	e.metric(&b, "planned_bytes", d.PlannedBytes, "c")
+	e.metric(&b, "bytes", d.Bytes, "c")
+	e.metric(&b, "writes", d.Writes, "c")
+	e.metric(&b, "errors", d.Errors, "c")
+	e.metric(&b, "retried_bytes", d.RetriedBytes, "c")
+	e.metric(&b, "abandoned_bytes", d.AbandonedBytes, "c")
+	e.metric(&b, "dropped_bytes", d.DroppedBytes, "c")
+	e.metric(&b, "catch_up_bytes", d.CatchUpBytes, "c")
+	if elapsed > 0 {
+		e.metric(&b, "rate", int64(float64(d.Bytes)/elapsed), "g")
+	}
+
+	// statsd over UDP is fire and forget: if a send fails, the counts in it
+	// are lost, just as they are when the server drops a packet
+	_, _ = e.conn.Write(b.Bytes())
+
+	e.last = s
+	e.lastT = now
+}
+
+func (e *StatsdEmitter) metric(b *bytes.Buffer, name string, value int64, kind string) {
+	fmt.Fprintf(b, "%s%s:%d|%s%s\n", e.prefix, name, value, kind, e.tags)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"time"
+)
+
+const (
+	SizeDistFixed       = "fixed"
+	SizeDistUniform     = "uniform"
+	SizeDistExponential = "exponential"
+)
+
+// randomAmount returns a random amount with the given mean and distribution,
+// like the size of a file or the length of a delay.
+func randomAmount(r *rand.Rand, mean int64, dist string) int64 {
+	switch dist {
+	case SizeDistUniform:
+		return r.Int63n(2*mean + 1)
+	case SizeDistExponential:
+		return int64(r.ExpFloat64() * float64(mean))
+	}
+	return mean
+}
+
+var errArchiveClosed = errors.New("archive closed")
+
+// TarArchive generates a tar archive of log files filled with random lines.
+// The archive is produced by a goroutine and read in pieces with WriteN, so
+// that the shaper paces the archive bytes instead of the lines.
+type TarArchive struct {
+	pr *io.PipeReader
+}
+
+// NewTarArchive starts generating an archive of the given number of files.
+// File sizes follow dist with the given mean and are picked using r, which
+// must also be the random source of out.
+func NewTarArchive(out *RandomOutput, r *rand.Rand, files int, mean int64, dist string) *TarArchive {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeTar(pw, out, r, files, mean, dist))
+	}()
+	return &TarArchive{pr: pr}
+}
+
+func writeTar(w io.Writer, out *RandomOutput, r *rand.Rand, files int, mean int64, dist string) error {
+	tw := tar.NewWriter(w)
+	modTime := time.Now()
+
+	var buf bytes.Buffer
+	for i := 0; i < files; i++ {
+		size := randomAmount(r, mean, dist)
+
+		buf.Reset()
+		if _, err := out.WriteN(&buf, int(size)); err != nil {
+			return err
+		}
+		// lines are written in full, so files end on whole lines and may be
+		// a little larger than size
+
+		hdr := &tar.Header{
+			Name:    fmt.Sprintf("rndout/log-%04d.log", i+1),
+			Mode:    0644,
+			Size:    int64(buf.Len()),
+			ModTime: modTime,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// WriteN copies the next n bytes of the archive to w. It returns io.EOF after
+// the end of the archive is written.
+func (a *TarArchive) WriteN(w io.Writer, n int) (int, error) {
+	written, err := io.CopyN(w, a.pr, int64(n))
+	return int(written), err
+}
+
+// Close stops generating the archive.
+func (a *TarArchive) Close() {
+	a.pr.CloseWithError(errArchiveClosed)
+}
@@ -0,0 +1,16 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows)
+
+package main
+
+import (
+	"os"
+)
+
+func isTerminal(f *os.File) bool {
+	return false
+}
+
+// terminalSize returns the width and height of the terminal attached to f.
+func terminalSize(f *os.File) (width, height int, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,35 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+type winsize struct {
+	Row, Col, Xpixel, Ypixel uint16
+}
+
+func getWinsize(f *os.File) (ws winsize, err error) {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&ws)))
+	if errno != 0 {
+		return ws, errno
+	}
+	return ws, nil
+}
+
+func isTerminal(f *os.File) bool {
+	_, err := getWinsize(f)
+	return err == nil
+}
+
+// terminalSize returns the width and height of the terminal attached to f.
+func terminalSize(f *os.File) (width, height int, ok bool) {
+	ws, err := getWinsize(f)
+	if err != nil || ws.Col == 0 || ws.Row == 0 {
+		return 0, 0, false
+	}
+	return int(ws.Col), int(ws.Row), true
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+func isTerminal(f *os.File) bool {
+	var mode uint32
+	return syscall.GetConsoleMode(syscall.Handle(f.Fd()), &mode) == nil
+}
+
+// terminalSize returns the width and height of the terminal attached to f.
+func terminalSize(f *os.File) (width, height int, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"math/rand"
+)
+
+const (
+	TextUniform = "uniform"
+	TextEnglish = "english"
+)
+
+// A TextFunc fills b with random text.
+type TextFunc func(b []byte, r *rand.Rand)
+
+// NewTextFunc returns the TextFunc for a text style, or nil if the style is
+// unknown.
+func NewTextFunc(style string) TextFunc {
+	switch style {
+	case TextUniform:
+		return UniformText
+	case TextEnglish:
+		return EnglishText
+	}
+	return nil
+}
+
+// UniformText fills b with characters picked uniformly from the alphabet.
+func UniformText(b []byte, r *rand.Rand) {
+	for i := range b {
+		b[i] = alphabet[r.Intn(len(alphabet))]
+	}
+}
+
+var (
+	// englishLetters and englishWordLengths hold each letter and word length
+	// a number of times proportional to its frequency in English text, so
+	// that picking uniformly from them follows the frequencies
+	englishLetters     = weightedTable("etaoinshrdlcumwfgypbvkjxqz", []int{127, 91, 82, 75, 70, 67, 63, 61, 60, 43, 40, 28, 28, 24, 24, 22, 20, 20, 19, 15, 10, 8, 2, 2, 1, 1})
+	englishWordLengths = weightedTable("\x01\x02\x03\x04\x05\x06\x07\x08\x09\x0a\x0b\x0c", []int{3, 17, 21, 16, 11, 8, 8, 6, 4, 3, 2, 1})
+)
+
+func weightedTable(values string, weights []int) []byte {
+	var table []byte
+	for i, w := range weights {
+		for j := 0; j < w; j++ {
+			table = append(table, values[i])
+		}
+	}
+	return table
+}
+
+// EnglishText fills b with word-like text: lowercase words with English
+// letter and word length frequencies, separated by spaces, with occasional
+// commas and periods. Words after a period are capitalized.
+func EnglishText(b []byte, r *rand.Rand) {
+	capital := false
+	for i := 0; i < len(b); {
+		n := int(englishWordLengths[r.Intn(len(englishWordLengths))])
+		for j := 0; j < n && i < len(b); j++ {
+			b[i] = englishLetters[r.Intn(len(englishLetters))]
+			if capital && j == 0 {
+				b[i] -= 'a' - 'A'
+			}
+			i++
+		}
+		capital = false
+
+		if i < len(b) {
+			switch p := r.Intn(100); {
+			case p < 6:
+				b[i] = '.'
+				capital = true
+				i++
+			case p < 11:
+				b[i] = ','
+				i++
+			}
+		}
+		if i < len(b) {
+			b[i] = ' '
+			i++
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	OverflowBuffer = "buffer"
+	OverflowDrop   = "drop"
+)
+
+func throttleMain(args []string) {
+	fs := flag.NewFlagSet("throttle", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: rndout throttle [flags]")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Copy stdin to stdout at the rate given by the shaper. The run ends when stdin")
+		fmt.Fprintln(fs.Output(), "is closed and all buffered input is written, or after the duration.")
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+
+	var shape shapeOptions
+	shape.addFlags(fs)
+	overflow := fs.String("overflow", OverflowBuffer, "what to do when input arrives faster than the shape allows, one of 'buffer' or 'drop'")
+	bufferSize := fs.Int("buffer-size", 1<<20, "maximum number of input bytes to hold before blocking or dropping input")
+	seed := fs.Int64("seed", 0, "seed for all random decisions; if 0, use the current time")
+	fs.Parse(args)
+
+	if *overflow != OverflowBuffer && *overflow != OverflowDrop {
+		die("invalid overflow: must be one of 'buffer' or 'drop'")
+	}
+	if *bufferSize < 1 {
+		die("invalid buffer size: must be at least 1")
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+
+	shaper, charsPerStep, err := shape.newShaper(rand.New(rand.NewSource(*seed)))
+	if err != nil {
+		die(err)
+	}
+
+	q := NewByteQueue(*bufferSize, *overflow == OverflowDrop)
+	go func() {
+		_, err := io.Copy(q, os.Stdin)
+		q.Close(err)
+	}()
+
+	end := make(chan struct{})
+	time.AfterFunc(shape.duration, func() { close(end) })
+
+	written, err := Throttle(os.Stdout, q, shaper, charsPerStep, shape.stepSize, end)
+	q.Report(os.Stderr, written)
+	if err != nil {
+		die(err)
+	}
+}
+
+// Throttle writes the contents of q to w at the rate given by the shaper
+// until q is closed and empty or end is closed.
+func Throttle(w io.Writer, q *ByteQueue, shaper RateShaper, charsPerStep float64, stepSize time.Duration, end <-chan struct{}) (written int64, err error) {
+	steps := time.NewTicker(stepSize)
+	defer steps.Stop()
+
+	for step := 0; ; step++ {
+		select {
+		case <-steps.C:
+			buf, done := q.Take(int(charsPerStep * shaper.Fraction(step)))
+			n, err := w.Write(buf)
+			written += int64(n)
+			if err != nil || done {
+				return written, err
+			}
+		case <-end:
+			return written, nil
+		}
+	}
+}
+
+// ByteQueue is a bounded queue of bytes with one writer and one reader. When
+// the queue is full, writes either block or drop the excess bytes.
+type ByteQueue struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	buf     []byte
+	max     int
+	drop    bool
+	closed  bool
+	stopped bool
+	err     error
+
+	read    int64
+	dropped int64
+	out     []byte
+}
+
+func NewByteQueue(max int, drop bool) *ByteQueue {
+	q := &ByteQueue{max: max, drop: drop}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *ByteQueue) Write(p []byte) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	n := len(p)
+	q.read += int64(n)
+	for len(p) > 0 {
+		free := q.max - len(q.buf)
+		if free == 0 || q.stopped {
+			if q.drop || q.stopped {
+				q.dropped += int64(len(p))
+				break
+			}
+			q.cond.Wait()
+			continue
+		}
+		if free > len(p) {
+			free = len(p)
+		}
+		q.buf = append(q.buf, p[:free]...)
+		p = p[free:]
+	}
+	return n, nil
+}
+
+// Close marks the end of the input.
+func (q *ByteQueue) Close(err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.err = err
+}
+
+// Take removes and returns up to n bytes from the queue. The returned slice
+// is valid until the next call to Take. It also returns true if the input is
+// closed and the queue is empty.
+func (q *ByteQueue) Take(n int) ([]byte, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if n > len(q.buf) {
+		n = len(q.buf)
+	}
+	q.out = append(q.out[:0], q.buf[:n]...)
+	q.buf = q.buf[:copy(q.buf, q.buf[n:])]
+	q.cond.Signal()
+
+	return q.out, q.closed && len(q.buf) == 0
+}
+
+// Stop discards all future input, unblocking any waiting writes.
+func (q *ByteQueue) Stop() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.stopped = true
+	q.cond.Broadcast()
+}
+
+// Closed returns true if the input is closed.
+func (q *ByteQueue) Closed() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.closed
+}
+
+// Report writes a summary of the input and output to w.
+func (q *ByteQueue) Report(w io.Writer, written int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	fmt.Fprintf(w, "read %d bytes, wrote %d bytes, dropped %d bytes, %d bytes unwritten\n", q.read, written, q.dropped, len(q.buf))
+	if q.err != nil {
+		fmt.Fprintf(w, "error reading input: %v\n", q.err)
+	}
+}
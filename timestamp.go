@@ -0,0 +1,88 @@
+package main
+
+import (
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DriftClock is a clock that drifts away from the system clock at a constant
+// rate and occasionally jumps forward or backward by a random amount. It is
+// safe for concurrent use.
+type DriftClock struct {
+	// Drift is the rate at which the clock gains (or loses, if negative) time
+	// relative to the system clock, in seconds per second.
+	Drift float64
+
+	// StepInterval is the mean time between jumps, which happen at random
+	// times. If zero, the clock does not jump.
+	StepInterval time.Duration
+
+	// StepSize is the maximum size of a jump in either direction.
+	StepSize time.Duration
+
+	mu       sync.Mutex
+	r        *rand.Rand
+	start    time.Time
+	offset   time.Duration
+	nextStep time.Time
+}
+
+func NewDriftClock(r *rand.Rand, start time.Time, drift float64, stepInterval, stepSize time.Duration) *DriftClock {
+	c := &DriftClock{
+		Drift:        drift,
+		StepInterval: stepInterval,
+		StepSize:     stepSize,
+		r:            r,
+		start:        start,
+		nextStep:     start,
+	}
+	if stepInterval > 0 {
+		c.nextStep = start.Add(c.stepDelay())
+	}
+	return c
+}
+
+func (c *DriftClock) Now() time.Time {
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for c.StepInterval > 0 && !now.Before(c.nextStep) {
+		c.offset += time.Duration(c.r.Int63n(int64(2*c.StepSize)+1)) - c.StepSize
+		c.nextStep = c.nextStep.Add(c.stepDelay())
+	}
+
+	drift := time.Duration(float64(now.Sub(c.start)) * c.Drift)
+	return now.Add(drift + c.offset)
+}
+
+// stepDelay returns the time until the next jump. Jumps are a Poisson
+// process, so the delays are exponentially distributed.
+func (c *DriftClock) stepDelay() time.Duration {
+	return time.Duration(c.r.ExpFloat64() * float64(c.StepInterval))
+}
+
+// TimestampDecorator prefixes each line with the current time of the clock,
+// followed by a space. The format is 'rfc3339', 'rfc3339nano', 'unix',
+// 'unixms', or a Go time layout.
+func TimestampDecorator(clock func() time.Time, format string) LineDecorator {
+	return func(prefix, suffix []byte) ([]byte, []byte) {
+		t := clock()
+		switch format {
+		case "rfc3339":
+			prefix = t.UTC().AppendFormat(prefix, "2006-01-02T15:04:05.000Z07:00")
+		case "rfc3339nano":
+			prefix = t.UTC().AppendFormat(prefix, time.RFC3339Nano)
+		case "unix":
+			prefix = strconv.AppendFloat(prefix, float64(t.UnixNano())/1e9, 'f', 3, 64)
+		case "unixms":
+			prefix = strconv.AppendInt(prefix, t.UnixNano()/1e6, 10)
+		default:
+			prefix = t.AppendFormat(prefix, format)
+		}
+		return append(prefix, ' '), suffix
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+)
+
+// StepTrace records what happened during a single step.
+type StepTrace struct {
+	Step    int
+	Time    time.Time
+	Planned int
+	Written int
+	Latency time.Duration
+	Skipped bool
+}
+
+var traceHeader = []string{"step", "time", "planned_bytes", "written_bytes", "latency", "skipped"}
+
+// Trace writes step traces as CSV.
+type Trace struct {
+	w *csv.Writer
+	c io.Closer
+}
+
+func NewTrace(w io.WriteCloser) *Trace {
+	t := &Trace{w: csv.NewWriter(w), c: w}
+	_ = t.w.Write(traceHeader)
+	return t
+}
+
+func (t *Trace) Record(st StepTrace) {
+	// the csv writer keeps the first error, which Close returns
+	_ = t.w.Write([]string{
+		strconv.Itoa(st.Step),
+		st.Time.Format(time.RFC3339Nano),
+		strconv.Itoa(st.Planned),
+		strconv.Itoa(st.Written),
+		strconv.FormatFloat(st.Latency.Seconds(), 'f', 6, 64),
+		strconv.FormatBool(st.Skipped),
+	})
+}
+
+func (t *Trace) Close() error {
+	t.w.Flush()
+	if err := t.w.Error(); err != nil {
+		t.c.Close()
+		return err
+	}
+	return t.c.Close()
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	tuiDefaultWidth  = 80
+	tuiDefaultHeight = 24
+
+	// number of lines used by the summary and legend
+	tuiTextLines = 7
+
+	minTUIInterval = 100 * time.Millisecond
+)
+
+type tuiSample struct {
+	target   float64
+	achieved float64
+}
+
+// TUI renders a live view of a run to a terminal, with a scrolling chart of
+// the target and achieved output rates.
+type TUI struct {
+	out      *os.File
+	stats    *Stats
+	start    time.Time
+	duration time.Duration
+
+	samples []tuiSample
+	last    Stats
+	lastT   time.Time
+}
+
+func NewTUI(out *os.File, stats *Stats, start time.Time, duration time.Duration) *TUI {
+	return &TUI{
+		out:      out,
+		stats:    stats,
+		start:    start,
+		duration: duration,
+		lastT:    start,
+	}
+}
+
+// Run redraws the display every interval until done is closed, then draws a
+// final frame and restores the cursor.
+func (t *TUI) Run(interval time.Duration, done <-chan struct{}) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	fmt.Fprint(t.out, "\x1b[?25l")
+	defer fmt.Fprint(t.out, "\x1b[?25h")
+
+	for {
+		select {
+		case <-tick.C:
+			t.Sample()
+			t.Draw()
+		case <-done:
+			t.Draw()
+			return
+		}
+	}
+}
+
+// Sample adds the rates since the previous sample to the chart.
+func (t *TUI) Sample() {
+	now := time.Now()
+	s := t.stats.Snapshot()
+	d := s.Sub(t.last)
+
+	var sample tuiSample
+	if dt := now.Sub(t.lastT).Seconds(); dt > 0 {
+		sample.target = float64(d.PlannedBytes) / dt
+		sample.achieved = float64(d.Bytes) / dt
+	}
+	t.samples = append(t.samples, sample)
+	t.last = s
+	t.lastT = now
+}
+
+func (t *TUI) Draw() {
+	now := time.Now()
+	s := t.stats.Snapshot()
+
+	var sample tuiSample
+	if len(t.samples) > 0 {
+		sample = t.samples[len(t.samples)-1]
+	}
+
+	width, height, ok := terminalSize(t.out)
+	if !ok {
+		width, height = tuiDefaultWidth, tuiDefaultHeight
+	}
+
+	var b bytes.Buffer
+	b.WriteString("\x1b[H\x1b[2J")
+	t.drawSummary(&b, now, s, sample)
+	t.drawChart(&b, width, height-tuiTextLines)
+	b.WriteString("# achieved  - target  = both\r\n")
+
+	// each frame redraws the whole screen, so a failed write is repaired by
+	// the next frame
+	_, _ = t.out.Write(b.Bytes())
+}
+
+func (t *TUI) drawSummary(w io.Writer, now time.Time, s Stats, sample tuiSample) {
+	elapsed := now.Sub(t.start).Truncate(time.Second)
+	pct := 100 * float64(now.Sub(t.start)) / float64(t.duration)
+	if pct > 100 {
+		pct = 100
+	}
+
+	health := "ok"
+	if s.Errors > 0 {
+		health = fmt.Sprintf("%d write errors", s.Errors)
+	}
+
+	fmt.Fprintf(w, "elapsed   %s / %s (%.0f%%)\r\n", elapsed, t.duration, pct)
+	fmt.Fprintf(w, "rate      target %s/s, achieved %s/s\r\n", formatBytes(sample.target), formatBytes(sample.achieved))
+	fmt.Fprintf(w, "total     %s in %d writes, %d of %d steps skipped\r\n", formatBytes(float64(s.Bytes)), s.Writes, s.SkippedSteps, s.Steps)
+	fmt.Fprintf(w, "sink      %s\r\n", health)
+}
+
+func (t *TUI) drawChart(w io.Writer, width, height int) {
+	const labelWidth = 12
+
+	cols := width - labelWidth
+	if cols < 1 || height < 1 {
+		return
+	}
+	if len(t.samples) > cols {
+		t.samples = t.samples[len(t.samples)-cols:]
+	}
+
+	var max float64
+	for _, s := range t.samples {
+		if s.target > max {
+			max = s.target
+		}
+		if s.achieved > max {
+			max = s.achieved
+		}
+	}
+	if max == 0 {
+		max = 1
+	}
+
+	fmt.Fprintf(w, "%*s\r\n", labelWidth-1, formatBytes(max)+"/s")
+	for row := 0; row < height; row++ {
+		// each row covers values in (lo, hi]
+		hi := max * float64(height-row) / float64(height)
+		lo := max * float64(height-row-1) / float64(height)
+
+		var line strings.Builder
+		line.WriteString(strings.Repeat(" ", labelWidth-1))
+		line.WriteByte('|')
+		for _, s := range t.samples {
+			bar := s.achieved > lo
+			target := s.target > lo && s.target <= hi
+			switch {
+			case bar && target:
+				line.WriteByte('=')
+			case target:
+				line.WriteByte('-')
+			case bar:
+				line.WriteByte('#')
+			default:
+				line.WriteByte(' ')
+			}
+		}
+		line.WriteString("\r\n")
+		io.WriteString(w, line.String())
+	}
+}
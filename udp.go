@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"net"
+)
+
+// UDPSink sends lines as UDP datagrams, packing as many whole lines into each
+// datagram as fit in the packet size. Lines longer than the packet size are
+// sent in their own datagrams and may be truncated by the network.
+type UDPSink struct {
+	conn       net.Conn
+	packetSize int
+	eol        string
+}
+
+func NewUDPSink(addr string, packetSize int, eol string) (*UDPSink, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &UDPSink{conn: conn, packetSize: packetSize, eol: eol}, nil
+}
+
+func (s *UDPSink) Write(p []byte) (written int, err error) {
+	eol := []byte(s.eol)
+	for len(p) > 0 {
+		// find the end of the last line that fits, or of the first line
+		n := 0
+		for n < len(p) {
+			i := bytes.Index(p[n:], eol)
+			if i < 0 {
+				i = len(p) - n
+			} else {
+				i += len(eol)
+			}
+			if n > 0 && n+i > s.packetSize {
+				break
+			}
+			n += i
+		}
+
+		// the final line ending is not needed in the datagram
+		if _, err := s.conn.Write(bytes.TrimSuffix(p[:n], eol)); err != nil {
+			return written, err
+		}
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ProfileBucket is the amount of data observed in one interval of a stream.
+type ProfileBucket struct {
+	Start float64 `json:"start"`
+	Bytes int64   `json:"bytes"`
+	Lines int64   `json:"lines"`
+	Rate  float64 `json:"rate"`
+}
+
+// ProfileSummary describes the distribution of rates in a profile.
+type ProfileSummary struct {
+	Duration float64 `json:"duration"`
+	Bytes    int64   `json:"bytes"`
+	Lines    int64   `json:"lines"`
+	Mean     float64 `json:"mean"`
+	P50      float64 `json:"p50"`
+	P90      float64 `json:"p90"`
+	P99      float64 `json:"p99"`
+	Max      float64 `json:"max"`
+}
+
+var profileHeader = []string{"start", "bytes", "lines", "rate"}
+
+func verifyMain(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: rndout verify [flags] [file]")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Measure the rate profile of a stream read from a file, stdin, or a TCP connection.")
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+
+	interval := fs.Duration("interval", time.Second, "length of each measurement interval")
+	format := fs.String("format", "csv", "the profile format, one of 'csv' or 'json'")
+	listen := fs.String("listen", "", "read from the first TCP connection accepted on this host:port instead of a file")
+	fs.Parse(args)
+
+	if *interval <= 0 {
+		die("invalid interval: must be greater than zero")
+	}
+	if *format != "csv" && *format != "json" {
+		die("invalid format: must be one of 'csv' or 'json'")
+	}
+
+	in, err := openInput(fs.Arg(0), *listen)
+	if err != nil {
+		die(err)
+	}
+	defer in.Close()
+
+	profile, err := MeasureProfile(in, *interval)
+	if err != nil {
+		die(err)
+	}
+	summary := SummarizeProfile(profile, *interval)
+
+	switch *format {
+	case "csv":
+		if err := WriteProfileCSV(os.Stdout, profile); err != nil {
+			die(err)
+		}
+		fmt.Fprintf(os.Stderr, "duration %.3fs, %d bytes, %d lines\n", summary.Duration, summary.Bytes, summary.Lines)
+		fmt.Fprintf(os.Stderr, "rate mean %.1f, p50 %.1f, p90 %.1f, p99 %.1f, max %.1f bytes/s\n", summary.Mean, summary.P50, summary.P90, summary.P99, summary.Max)
+
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err := enc.Encode(struct {
+			Interval float64         `json:"interval"`
+			Profile  []ProfileBucket `json:"profile"`
+			Summary  ProfileSummary  `json:"summary"`
+		}{interval.Seconds(), profile, summary})
+		if err != nil {
+			die(err)
+		}
+	}
+}
+
+// openInput opens the named file, stdin if the name is empty or "-", or the
+// first TCP connection accepted on the listen address if it is set.
+func openInput(name, listen string) (io.ReadCloser, error) {
+	if listen != "" {
+		l, err := net.Listen("tcp", listen)
+		if err != nil {
+			return nil, err
+		}
+		defer l.Close()
+		return l.Accept()
+	}
+	if name == "" || name == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(name)
+}
+
+// MeasureProfile reads r until EOF and counts the bytes and lines received in
+// each interval. Intervals start when the first byte is received.
+func MeasureProfile(r io.Reader, interval time.Duration) ([]ProfileBucket, error) {
+	var profile []ProfileBucket
+	var start time.Time
+
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			now := time.Now()
+			if start.IsZero() {
+				start = now
+			}
+
+			i := int(now.Sub(start) / interval)
+			for len(profile) <= i {
+				profile = append(profile, ProfileBucket{
+					Start: (time.Duration(len(profile)) * interval).Seconds(),
+				})
+			}
+			profile[i].Bytes += int64(n)
+			profile[i].Lines += int64(bytes.Count(buf[:n], []byte{'\n'}))
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return profile, err
+		}
+	}
+
+	for i := range profile {
+		profile[i].Rate = float64(profile[i].Bytes) / interval.Seconds()
+	}
+	return profile, nil
+}
+
+func SummarizeProfile(profile []ProfileBucket, interval time.Duration) ProfileSummary {
+	s := ProfileSummary{
+		Duration: (time.Duration(len(profile)) * interval).Seconds(),
+	}
+	if len(profile) == 0 {
+		return s
+	}
+
+	rates := make([]float64, len(profile))
+	for i, b := range profile {
+		s.Bytes += b.Bytes
+		s.Lines += b.Lines
+		rates[i] = b.Rate
+	}
+	sort.Float64s(rates)
+
+	s.Mean = float64(s.Bytes) / s.Duration
+	s.P50 = percentile(rates, 50)
+	s.P90 = percentile(rates, 90)
+	s.P99 = percentile(rates, 99)
+	s.Max = rates[len(rates)-1]
+	return s
+}
+
+// percentile returns the p-th percentile of sorted values using the
+// nearest-rank method.
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
+
+func WriteProfileCSV(w io.Writer, profile []ProfileBucket) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(profileHeader); err != nil {
+		return err
+	}
+	for _, b := range profile {
+		err := cw.Write([]string{
+			strconv.FormatFloat(b.Start, 'f', -1, 64),
+			strconv.FormatInt(b.Bytes, 10),
+			strconv.FormatInt(b.Lines, 10),
+			strconv.FormatFloat(b.Rate, 'f', 1, 64),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
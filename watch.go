@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const watchInterval = time.Second
+
+// WatchConfig holds the settings that a -watch file can change while
+// running: the rate, the shape parameters, and the event mix.
+type WatchConfig struct {
+	Shape  shapeOptions
+	Events string
+}
+
+// ParseWatchConfig parses the contents of a -watch file, starting from the
+// settings in base. Each line is a flag without the leading dash, like
+// 'rate=10k' or 'rate 10k'; blank lines and lines starting with # are
+// ignored.
+func ParseWatchConfig(b []byte, base WatchConfig) (WatchConfig, error) {
+	var c WatchConfig
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	c.Shape.addFlags(fs)
+	fs.StringVar(&c.Events, "events", "", "")
+
+	// registering the flags sets their defaults, so start from base after
+	c = base
+	c.Shape.seasons = nil
+
+	var args []string
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if i := strings.IndexAny(line, "= \t"); i >= 0 {
+			line = line[:i] + "=" + strings.TrimSpace(line[i+1:])
+		}
+		args = append(args, "-"+line)
+	}
+	if err := fs.Parse(args); err != nil {
+		return base, err
+	}
+
+	seasons := false
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "duration", "step-size":
+			err = fmt.Errorf("-%s can't be changed while running", f.Name)
+		case "season":
+			seasons = true
+		}
+	})
+	if err != nil {
+		return base, err
+	}
+	if !seasons {
+		c.Shape.seasons = base.Shape.seasons
+	}
+	return c, nil
+}
+
+// ReadWatchConfig reads a -watch file. A missing file has no settings.
+func ReadWatchConfig(name string, base WatchConfig) (WatchConfig, error) {
+	b, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return base, nil
+	}
+	if err != nil {
+		return base, err
+	}
+	return ParseWatchConfig(b, base)
+}
+
+// WatchConfigFile checks a -watch file for changes every interval until done
+// is closed and sends the new settings to configs. If configs is full, the
+// new settings replace the unread ones. Invalid files are reported on stderr
+// and ignored.
+func WatchConfigFile(name string, base WatchConfig, interval time.Duration, configs chan WatchConfig, done <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	var modTime time.Time
+	var size int64
+	if fi, err := os.Stat(name); err == nil {
+		modTime, size = fi.ModTime(), fi.Size()
+	}
+
+	for {
+		select {
+		case <-t.C:
+		case <-done:
+			return
+		}
+
+		fi, err := os.Stat(name)
+		if err != nil || (fi.ModTime().Equal(modTime) && fi.Size() == size) {
+			continue
+		}
+		modTime, size = fi.ModTime(), fi.Size()
+
+		c, err := ReadWatchConfig(name, base)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid watch file %s, keeping the current settings: %v\n", name, err)
+			continue
+		}
+		select {
+		case <-configs:
+		default:
+		}
+		configs <- c
+	}
+}
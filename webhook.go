@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const defaultWebhookTemplate = `{{json .Lines}}`
+
+// WebhookBatch is the data passed to a webhook body template.
+type WebhookBatch struct {
+	// Lines are the lines in the batch, without line endings.
+	Lines []string
+
+	// Batch is the number of the batch, starting from zero.
+	Batch int
+
+	// Time is the time the batch was sent.
+	Time time.Time
+}
+
+// WebhookSink sends each write as a batch of lines in the body of a POST
+// request. The body is generated from a template. Responses with status 429 or
+// 5xx return transient errors.
+type WebhookSink struct {
+	url    string
+	header http.Header
+	tmpl   *template.Template
+	client *http.Client
+	eol    string
+
+	batch int
+	body  bytes.Buffer
+}
+
+// NewWebhookSink creates a sink that posts to url. Headers have the form
+// "Name: value". In the template, the json function encodes a value as JSON
+// and the join function joins a list of strings with a separator.
+func NewWebhookSink(url, body string, headers []string, eol string) (*WebhookSink, error) {
+	tmpl, err := template.New("body").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+		"join": func(sep string, s []string) string {
+			return strings.Join(s, sep)
+		},
+	}).Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook template: %w", err)
+	}
+
+	h := make(http.Header)
+	h.Set("Content-Type", "application/json")
+	if err := addHeaders(h, "webhook", headers); err != nil {
+		return nil, err
+	}
+
+	return &WebhookSink{
+		url:    url,
+		header: h,
+		tmpl:   tmpl,
+		client: &http.Client{Timeout: sinkTimeout},
+		eol:    eol,
+	}, nil
+}
+
+// Write sends p, which must contain whole lines, as one batch.
+func (s *WebhookSink) Write(p []byte) (int, error) {
+	lines := strings.Split(strings.TrimSuffix(string(p), s.eol), s.eol)
+
+	s.body.Reset()
+	if err := s.tmpl.Execute(&s.body, WebhookBatch{Lines: lines, Batch: s.batch, Time: time.Now()}); err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(s.body.Bytes()))
+	if err != nil {
+		return 0, err
+	}
+	req.Header = s.header.Clone()
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	// drain the body so the connection is reused
+	_, _ = io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		err := fmt.Errorf("webhook returned %s", res.Status)
+		if res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500 {
+			return 0, transientError{err}
+		}
+		return 0, err
+	}
+
+	s.batch++
+	return len(p), nil
+}
+
+// addHeaders adds headers of the form "Name: value" to h, replacing any
+// existing values. The sink name describes the headers in error messages.
+func addHeaders(h http.Header, sink string, headers []string) error {
+	for _, hdr := range headers {
+		name, value, ok := strings.Cut(hdr, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return fmt.Errorf("invalid %s header %q: must have the form 'Name: value'", sink, hdr)
+		}
+		h.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	return nil
+}
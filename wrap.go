@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+func wrapMain(args []string) {
+	fs := flag.NewFlagSet("wrap", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: rndout wrap [flags] -- command [args...]")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Run a command and copy its stdout and stderr to rndout's stdout and stderr,")
+		fmt.Fprintln(fs.Output(), "shaping the rate of each stream independently. The command is killed if it is")
+		fmt.Fprintln(fs.Output(), "still running after the duration. Exits with the command's exit status.")
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+
+	var shape shapeOptions
+	shape.addFlags(fs)
+	overflow := fs.String("overflow", OverflowBuffer, "what to do when a stream produces output faster than the shape allows, one of 'buffer' or 'drop'")
+	bufferSize := fs.Int("buffer-size", 1<<20, "maximum number of bytes to hold for each stream before blocking or dropping output")
+	seed := fs.Int64("seed", 0, "seed for all random decisions; if 0, use the current time")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *overflow != OverflowBuffer && *overflow != OverflowDrop {
+		die("invalid overflow: must be one of 'buffer' or 'drop'")
+	}
+	if *bufferSize < 1 {
+		die("invalid buffer size: must be at least 1")
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	r := rand.New(rand.NewSource(*seed))
+
+	cmd := exec.Command(fs.Arg(0), fs.Args()[1:]...)
+	cmd.Stdin = os.Stdin
+
+	streams := []struct {
+		name string
+		out  io.Writer
+		pipe func() (io.ReadCloser, error)
+	}{
+		{"stdout", os.Stdout, cmd.StdoutPipe},
+		{"stderr", os.Stderr, cmd.StderrPipe},
+	}
+
+	end := make(chan struct{})
+	queues := make([]*ByteQueue, len(streams))
+	written := make([]int64, len(streams))
+	errs := make([]error, len(streams))
+
+	var copies, pacers sync.WaitGroup
+	for i, s := range streams {
+		shaper, charsPerStep, err := shape.newShaper(r)
+		if err != nil {
+			die(err)
+		}
+		pipe, err := s.pipe()
+		if err != nil {
+			die(err)
+		}
+
+		q := NewByteQueue(*bufferSize, *overflow == OverflowDrop)
+		queues[i] = q
+
+		copies.Add(1)
+		go func() {
+			defer copies.Done()
+			_, err := io.Copy(q, pipe)
+			q.Close(err)
+		}()
+
+		i, out := i, s.out
+		pacers.Add(1)
+		go func() {
+			defer pacers.Done()
+			written[i], errs[i] = Throttle(out, q, shaper, charsPerStep, shape.stepSize, end)
+		}()
+	}
+
+	if err := cmd.Start(); err != nil {
+		die(err)
+	}
+	time.AfterFunc(shape.duration, func() { close(end) })
+
+	pacers.Wait()
+	for _, q := range queues {
+		if !q.Closed() {
+			_ = cmd.Process.Kill()
+		}
+		q.Stop()
+	}
+	copies.Wait()
+	err := cmd.Wait()
+
+	for i, s := range streams {
+		fmt.Fprintf(os.Stderr, "%s: ", s.name)
+		queues[i].Report(os.Stderr, written[i])
+		if errs[i] != nil {
+			fmt.Fprintf(os.Stderr, "%s: error writing output: %v\n", s.name, errs[i])
+		}
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		os.Exit(exitErr.ExitCode())
+	case err != nil:
+		die(err)
+	}
+}